@@ -0,0 +1,104 @@
+package mosaic
+
+import (
+	"math"
+	"sort"
+)
+
+// adjustPixel scales the HSV saturation and value of p by SaturationScale
+// and BrightnessScale, clamping both to [0,1]
+func (opts *MosaicOptions) adjustPixel(p Pixel) Pixel {
+	sat, bright := opts.SaturationScale, opts.BrightnessScale
+	if (sat == 0 || sat == 1) && (bright == 0 || bright == 1) {
+		return p
+	}
+
+	h, s, v := pixelToHSV(p)
+	if sat != 0 {
+		s = clamp01(s * sat)
+	}
+	if bright != 0 {
+		v = clamp01(v * bright)
+	}
+	return hsvToPixel(h, s, v)
+}
+
+// pixelToHSV converts p to hue in [0,6), saturation and value
+func pixelToHSV(p Pixel) (h, s, v float64) {
+	r, g, b := clamp01(p.R), clamp01(p.G), clamp01(p.B)
+	v = max(r, g, b)
+	c := v - min(r, g, b)
+	if v > 0 {
+		s = c / v
+	}
+	switch {
+	case c == 0:
+		h = 0
+	case v == r:
+		h = math.Mod((g-b)/c+6, 6)
+	case v == g:
+		h = (b-r)/c + 2
+	default:
+		h = (r-g)/c + 4
+	}
+	return h, s, v
+}
+
+// hsvToPixel converts hue in [0,6), saturation and value to a pixel
+func hsvToPixel(h, s, v float64) Pixel {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	m := v - c
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	return Pixel{R: r + m, G: g + m, B: b + m}
+}
+
+// sortByHue orders centroids by the hue, then saturation, then value of
+// their output colors, reordering the matching cluster sizes along with them
+func (opts *MosaicOptions) sortByHue(centroids []Pixel, sizes []int) {
+	type entry struct {
+		centroid Pixel
+		size     int
+		hsv      [3]float64
+	}
+	entries := make([]entry, len(centroids))
+	for i, c := range centroids {
+		h, s, v := pixelToHSV(opts.outputPixel(c))
+		entries[i] = entry{centroid: c, hsv: [3]float64{h, s, v}}
+		if i < len(sizes) {
+			entries[i].size = sizes[i]
+		}
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		x, y := entries[a].hsv, entries[b].hsv
+		if x[0] != y[0] {
+			return x[0] < y[0]
+		}
+		if x[1] != y[1] {
+			return x[1] < y[1]
+		}
+		return x[2] < y[2]
+	})
+
+	for i, e := range entries {
+		centroids[i] = e.centroid
+		if i < len(sizes) {
+			sizes[i] = e.size
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestHSVRoundTrip(t *testing.T) {
+	for _, p := range []Pixel{{}, {R: 1, G: 1, B: 1}, {R: 1}, {G: 0.5, B: 0.25}, {R: 0.2, G: 0.4, B: 0.9}, {R: 0.9, G: 0.1, B: 0.6}} {
+		h, s, v := pixelToHSV(p)
+		got := hsvToPixel(h, s, v)
+		if math.Abs(got.R-p.R)+math.Abs(got.G-p.G)+math.Abs(got.B-p.B) > 1e-9 {
+			t.Errorf("hsvToPixel(pixelToHSV(%v)) = %v", p, got)
+		}
+	}
+}
+
+func TestSaturationBrightnessScale(t *testing.T) {
+	// Create a muted two-color image
+	muted := []color.RGBA{{R: 150, G: 120, B: 110, A: 255}, {R: 110, G: 120, B: 150, A: 255}}
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, muted[x/10])
+		}
+	}
+
+	tests := []struct {
+		name               string
+		saturation, bright float64
+		wantS, wantV       float64 // output over input saturation and value
+	}{
+		{"unset", 0, 0, 1, 1},
+		{"saturate", 2, 0, 2, 1},
+		{"darken", 1, 0.5, 1, 0.5},
+		{"clamped", 10, 10, 0, 0}, // saturation and value reach 1
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.K = 2
+			opts.SaturationScale = tt.saturation
+			opts.BrightnessScale = tt.bright
+
+			result := CreateMosaicRGBA(img, opts)
+
+			for i, c := range muted {
+				_, inS, inV := pixelToHSV(rgbaToPixel(c))
+				_, s, v := pixelToHSV(rgbaToPixel(result.RGBAAt(i*10+5, 5)))
+				wantS, wantV := inS*tt.wantS, inV*tt.wantV
+				if tt.wantS == 0 {
+					wantS, wantV = 1, 1
+				}
+				if math.Abs(s-wantS) > 0.02 || math.Abs(v-wantV) > 0.02 {
+					t.Errorf("block %d saturation, value = %.3f, %.3f, want %.3f, %.3f", i, s, v, wantS, wantV)
+				}
+			}
+		})
+	}
+}
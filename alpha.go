@@ -0,0 +1,37 @@
+package mosaic
+
+import "image"
+
+// transparentMask returns a function reporting whether the pixel at (x, y)
+// is too transparent to count toward clustering and block colors, or nil
+// when IgnoreTransparent is off
+func (opts *MosaicOptions) transparentMask(img image.Image) func(x, y int) bool {
+	if !opts.IgnoreTransparent {
+		return nil
+	}
+	threshold := max(1, opts.AlphaThreshold)
+	alphaAt := alphaReader(img)
+	return func(x, y int) bool {
+		return alphaAt(x, y) < threshold
+	}
+}
+
+// alphaReader returns a function reading the 8-bit alpha at (x, y), straight
+// from the Pix slice for RGBA and NRGBA images
+func alphaReader(img image.Image) func(x, y int) uint8 {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return func(x, y int) uint8 {
+			return img.Pix[img.PixOffset(x, y)+3]
+		}
+	case *image.NRGBA:
+		return func(x, y int) uint8 {
+			return img.Pix[img.PixOffset(x, y)+3]
+		}
+	default:
+		return func(x, y int) uint8 {
+			_, _, _, a := img.At(x, y).RGBA()
+			return uint8(a >> 8)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package mosaic
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// spritePNG returns a decoded PNG with a transparent green border around an
+// opaque center of red and blue halves
+func spritePNG(t *testing.T) image.Image {
+	t.Helper()
+
+	width, height := 40, 40
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case x < 10 || x >= 30 || y < 10 || y >= 30:
+				img.SetNRGBA(x, y, color.NRGBA{G: 255})
+			case x < 20:
+				img.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+			default:
+				img.SetNRGBA(x, y, color.NRGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	return decoded
+}
+
+func TestIgnoreTransparentPalette(t *testing.T) {
+	img := spritePNG(t)
+
+	opts := DefaultOptions()
+	opts.K = 3
+	opts.IgnoreTransparent = true
+
+	// Transparent pixels read as black once premultiplied, so without
+	// IgnoreTransparent black would be among the palette colors
+	for _, c := range ExtractPalette(img, opts) {
+		if int(c.R)+int(c.B) < 200 {
+			t.Errorf("palette color %v comes from the transparent border", c)
+		}
+	}
+}
+
+func TestIgnoreTransparentBlocks(t *testing.T) {
+	img := spritePNG(t)
+
+	for _, layout := range []BlockLayout{LayoutGrid, LayoutHex} {
+		opts := DefaultOptions()
+		opts.K = 2
+		opts.IgnoreTransparent = true
+		opts.BlockLayout = layout
+
+		result := CreateMosaic(img, opts)
+
+		// Blocks of the transparent border are left untouched
+		if _, _, _, a := result.At(2, 2).RGBA(); a != 0 {
+			t.Errorf("layout %d: border pixel = %v, want transparent", layout, result.At(2, 2))
+		}
+		// The center is mosaicked from the visible pixels
+		if got, want := result.At(15, 15), img.At(15, 15); !sameRGBA(got, want) {
+			t.Errorf("layout %d: center pixel = %v, want %v", layout, got, want)
+		}
+	}
+}
+
+func TestAlphaThreshold(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 0})
+	img.SetNRGBA(1, 0, color.NRGBA{G: 255, A: 100})
+	img.SetNRGBA(2, 0, color.NRGBA{B: 255, A: 200})
+	img.SetNRGBA(3, 0, color.NRGBA{R: 255, G: 255, A: 255})
+	region := resolveRegion(img.Bounds(), nil)
+
+	tests := []struct {
+		name      string
+		ignore    bool
+		threshold uint8
+		want      int
+	}{
+		{"off", false, 0, 4},
+		{"fully transparent only", true, 0, 3},
+		{"threshold 150", true, 150, 2},
+		{"threshold 255", true, 255, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.IgnoreTransparent = tt.ignore
+			opts.AlphaThreshold = tt.threshold
+			if got := len(opts.readPixels(img, region)); got != tt.want {
+				t.Errorf("readPixels() returned %d pixels, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// sameRGBA reports whether two colors have equal premultiplied components
+func sameRGBA(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
@@ -0,0 +1,92 @@
+package mosaic
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// defaultFrameDelay is the RenderIterations frame delay used when FrameDelay
+// is not positive
+const defaultFrameDelay = 50
+
+// RenderIterations clusters the image like CreateMosaic and writes an
+// animated GIF to w with one mosaic frame per k-means iteration, showing how
+// the palette converges. Frames are FrameDelay apart.
+func RenderIterations(img image.Image, opts *MosaicOptions, w io.Writer) error {
+	opts = opts.Normalize()
+
+	// Capture the centroids of every iteration
+	var iterations [][]Pixel
+	capture := *opts
+	capture.IterationFunc = func(iteration int, centroids []Pixel) {
+		iterations = append(iterations, append([]Pixel(nil), centroids...))
+		if opts.IterationFunc != nil {
+			opts.IterationFunc(iteration, centroids)
+		}
+	}
+	// Cluster the pre-blurred image, as CreateMosaic does
+	clustered := capture.withInvertedRegions()
+	regions := clustered.regions(img.Bounds())
+	clusterRegions(clustered.preBlur(img, regions), regions, clustered)
+
+	if len(iterations) == 0 {
+		return errors.New("mosaic: no k-means iterations to render")
+	}
+
+	delay := opts.FrameDelay
+	if delay <= 0 {
+		delay = defaultFrameDelay
+	}
+
+	// Render each iteration as a mosaic painted with its centroids, which
+	// are converted to output colors only once
+	anim := &gif.GIF{}
+	for _, centroids := range iterations {
+		frameOpts := *opts
+		frameOpts.IterationFunc = nil
+		frameOpts.centroids = centroids
+		colors := make([]color.RGBA, len(centroids))
+		for i, c := range centroids {
+			colors[i] = opts.outputPixel(c).ToRGBA()
+		}
+
+		anim.Image = append(anim.Image, palettedFrame(CreateMosaic(img, &frameOpts), colors))
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return fmt.Errorf("mosaic: encoding gif: %w", err)
+	}
+
+	return nil
+}
+
+// palettedFrame converts a mosaic to a GIF frame whose palette holds the
+// block colors exactly, filled up with web-safe colors for the pixels
+// outside the mosaicked regions
+func palettedFrame(mosaic image.Image, colors []color.RGBA) *image.Paletted {
+	pal := make(color.Palette, 0, 256)
+	for _, c := range colors {
+		if len(pal) == cap(pal) {
+			break
+		}
+		pal = append(pal, c)
+	}
+	for _, c := range palette.WebSafe {
+		if len(pal) == cap(pal) {
+			break
+		}
+		pal = append(pal, c)
+	}
+
+	bounds := mosaic.Bounds()
+	frame := image.NewPaletted(bounds, pal)
+	draw.Draw(frame, bounds, mosaic, bounds.Min, draw.Src)
+	return frame
+}
@@ -0,0 +1,113 @@
+package mosaic
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestRenderIterations(t *testing.T) {
+	// Create test image with a gradient so that k-means needs several
+	// iterations
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 6), B: 128, A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 4
+	opts.FrameDelay = 20
+
+	iterations := 0
+	opts.IterationFunc = func(iteration int, centroids []Pixel) {
+		iterations = iteration
+	}
+
+	var buf bytes.Buffer
+	if err := RenderIterations(img, opts, &buf); err != nil {
+		t.Fatalf("RenderIterations() error = %v", err)
+	}
+
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("decoding gif: %v", err)
+	}
+
+	if iterations == 0 {
+		t.Fatal("IterationFunc was never called")
+	}
+	if len(anim.Image) != iterations {
+		t.Errorf("got %d frames, want %d (iterations run)", len(anim.Image), iterations)
+	}
+	for i, d := range anim.Delay {
+		if d != opts.FrameDelay {
+			t.Errorf("frame %d delay = %d, want %d", i, d, opts.FrameDelay)
+		}
+	}
+}
+
+func TestRenderIterationsFixedPalette(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Palette = []color.RGBA{{A: 255}}
+
+	var buf bytes.Buffer
+	if err := RenderIterations(image.NewRGBA(image.Rect(0, 0, 10, 10)), opts, &buf); err == nil {
+		t.Error("RenderIterations() with a fixed palette succeeded, want error")
+	}
+}
+
+func TestRenderIterationsMatchesCreateMosaic(t *testing.T) {
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 6), B: uint8((x * y) % 256), A: 255})
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*MosaicOptions)
+	}{
+		{"adjusted colors", func(o *MosaicOptions) { o.SaturationScale, o.BrightnessScale = 1.5, 0.8 }},
+		{"pre-blur", func(o *MosaicOptions) { o.PreBlurRadius = 3 }},
+		{"inverted region", func(o *MosaicOptions) { o.Region = &Region{X: 20, Y: 0, Width: 20, Height: 40, Invert: true} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.K = 4
+			opts.InitMethod = InitPlusPlus
+			opts.Seed = 1
+			tt.modify(opts)
+
+			var buf bytes.Buffer
+			if err := RenderIterations(img, opts, &buf); err != nil {
+				t.Fatalf("RenderIterations() error = %v", err)
+			}
+			anim, err := gif.DecodeAll(&buf)
+			if err != nil {
+				t.Fatalf("decoding gif: %v", err)
+			}
+
+			// The last frame shows the converged palette. Only the left half
+			// is compared, as the GIF palette only approximates the original
+			// pixels of an inverted region.
+			frame := anim.Image[len(anim.Image)-1]
+			want := CreateMosaic(img, opts)
+			for y := 0; y < height; y++ {
+				for x := 0; x < width/2; x++ {
+					if got, want := color.RGBAModel.Convert(frame.At(x, y)), want.At(x, y); got != want {
+						t.Fatalf("frame pixel (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// detectBackground returns the most common color along the image border
+func detectBackground(img image.Image) color.RGBA {
+	bounds := img.Bounds()
+	counts := make(map[color.RGBA]int)
+
+	count := func(x, y int) {
+		c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+		counts[c]++
+	}
+
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		count(x, bounds.Min.Y)
+		if bounds.Dy() > 1 {
+			count(x, bounds.Max.Y-1)
+		}
+	}
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		count(bounds.Min.X, y)
+		if bounds.Dx() > 1 {
+			count(bounds.Max.X-1, y)
+		}
+	}
+
+	var background color.RGBA
+	best := 0
+	for c, n := range counts {
+		// Break ties deterministically since map order is random
+		if n > best || (n == best && rgbaLess(c, background)) {
+			background = c
+			best = n
+		}
+	}
+
+	return background
+}
+
+// rgbaLess orders colors by their R, G, B and A components
+func rgbaLess(a, b color.RGBA) bool {
+	if a.R != b.R {
+		return a.R < b.R
+	}
+	if a.G != b.G {
+		return a.G < b.G
+	}
+	if a.B != b.B {
+		return a.B < b.B
+	}
+	return a.A < b.A
+}
+
+// keyColor makes every pixel of rect within tolerance of the key color
+// transparent
+func keyColor(img draw.Image, rect image.Rectangle, key color.RGBA, tolerance float64) {
+	keyPixel := rgbaToPixel(key)
+	transparent := color.RGBA{}
+
+	bounds := rect.Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if distance(PixelFromColor(img.At(x, y)), keyPixel) <= tolerance {
+				img.Set(x, y, transparent)
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestAutoKeyBackground(t *testing.T) {
+	// Create test image with a uniform green border around a red center
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	green := color.RGBA{G: 255, A: 255}
+	red := color.RGBA{R: 255, A: 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x >= 10 && x < 30 && y >= 10 && y < 30 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, green)
+			}
+		}
+	}
+
+	if got := detectBackground(img); got != green {
+		t.Fatalf("detectBackground() = %v, want %v", got, green)
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.AutoKeyBackground = true
+
+	result := CreateMosaic(img, opts)
+
+	if _, _, _, a := result.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("border pixel alpha = %d, want 0", a)
+	}
+
+	if got := result.At(width/2, height/2); got != red {
+		t.Errorf("center pixel = %v, want %v", got, red)
+	}
+}
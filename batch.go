@@ -0,0 +1,55 @@
+package mosaic
+
+import (
+	"image"
+	"image/draw"
+)
+
+// CreateGridMosaic splits the image into a rows x cols grid of equal cells,
+// e.g. the thumbnails of a contact sheet, and mosaics each cell on its own
+// with an independent palette. cellOpts returns the options for the cell at
+// row, col; its Region and Regions are replaced by the cell. A nil cellOpts
+// or nil result uses DefaultOptions.
+func CreateGridMosaic(img image.Image, rows, cols int, cellOpts func(row, col int) *MosaicOptions) image.Image {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+	if rows <= 0 || cols <= 0 {
+		return out
+	}
+
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			cell := gridCell(bounds, rows, cols, row, col)
+			if cell.Empty() {
+				continue
+			}
+
+			var base *MosaicOptions
+			if cellOpts != nil {
+				base = cellOpts(row, col)
+			}
+			if base == nil {
+				base = DefaultOptions()
+			}
+			opts := *base
+			opts.Region = &Region{X: cell.Min.X, Y: cell.Min.Y, Width: cell.Dx(), Height: cell.Dy()}
+			opts.Regions = nil
+
+			result := CreateMosaic(img, &opts)
+			draw.Draw(out, cell, result, cell.Min, draw.Src)
+		}
+	}
+
+	return out
+}
+
+// gridCell returns the bounds of the cell at row, col when bounds is split
+// into rows x cols cells, spreading any remainder across the cells
+func gridCell(bounds image.Rectangle, rows, cols, row, col int) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	return image.Rect(
+		bounds.Min.X+col*w/cols, bounds.Min.Y+row*h/rows,
+		bounds.Min.X+(col+1)*w/cols, bounds.Min.Y+(row+1)*h/rows,
+	)
+}
@@ -0,0 +1,43 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCreateGridMosaic(t *testing.T) {
+	// Create a 2x2 contact sheet where each quadrant is split into two
+	// colors of its own, eight colors in total
+	width, height := 40, 40
+	colors := [2][2][2]color.RGBA{
+		{{{R: 255, A: 255}, {G: 255, A: 255}}, {{B: 255, A: 255}, {R: 255, G: 255, A: 255}}},
+		{{{G: 255, B: 255, A: 255}, {R: 255, B: 255, A: 255}}, {{A: 255}, {R: 255, G: 255, B: 255, A: 255}}},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			half := 0
+			if x%20 >= 10 {
+				half = 1
+			}
+			img.Set(x, y, colors[y/20][x/20][half])
+		}
+	}
+
+	// Two colors per cell can only reproduce every quadrant exactly when
+	// each cell gets its own palette
+	result := CreateGridMosaic(img, 2, 2, func(row, col int) *MosaicOptions {
+		opts := DefaultOptions()
+		opts.K = 2
+		return opts
+	})
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got, want := result.At(x, y), img.At(x, y); got != want {
+				t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package mosaic
+
+import (
+	"image"
+	"math/rand"
+)
+
+// regionBlocks returns the blocks covering a region. Grid blocks have the
+// full block size and may extend past the region's right and bottom edges.
+// Stripe layouts stretch blocks across the region and are not subdivided.
+// With BlockJitter, grid rows may also start with a block extending past the
+// region's left edge.
+func regionBlocks(img image.Image, region *Region, opts *MosaicOptions) []image.Rectangle {
+	stride := opts.blockStride()
+	dims := opts.blockDims()
+	switch opts.BlockLayout {
+	case LayoutHStripe:
+		dims.X, stride.X = region.Width, region.Width
+	case LayoutVStripe:
+		dims.Y, stride.Y = region.Height, region.Height
+	}
+	stripes := opts.BlockLayout == LayoutHStripe || opts.BlockLayout == LayoutVStripe
+
+	var jitter *rand.Rand
+	if opts.BlockJitter > 0 && opts.BlockLayout == LayoutGrid {
+		jitter = opts.random()
+	}
+
+	var blocks []image.Rectangle
+	for y := region.Y; y < region.Y+region.Height; y += stride.Y {
+		start := region.X
+		if jitter != nil {
+			if shift := jitter.Intn(opts.BlockJitter+1) % stride.X; shift > 0 {
+				start += shift - stride.X
+			}
+		}
+		for x := start; x < region.X+region.Width; x += stride.X {
+			block := image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x, y).Add(dims)}
+			if stripes {
+				blocks = append(blocks, block)
+			} else if opts.DensityMap != nil {
+				blocks = subdivideByDensity(blocks, img.Bounds(), region, block, opts)
+			} else if opts.AdaptiveBlocks {
+				blocks = subdivideBlock(blocks, img, region, block, opts)
+			} else {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+
+	return blocks
+}
+
+// collapseBlocks returns an image with one pixel per grid cell of the region,
+// colored by the block covering the cell's origin. Cells are stride apart.
+func collapseBlocks(region *Region, blocks []mosaicBlock, stride image.Point) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, ceilDiv(region.Width, stride.X), ceilDiv(region.Height, stride.Y)))
+
+	// Blocks are in scan order, so the block starting at a cell's origin is
+	// painted after any overlapping block that covers it
+	for _, block := range blocks {
+		c := block.color.ToRGBA()
+		cells := blockCells(region, block.rect, stride).Intersect(out.Bounds())
+		for cy := cells.Min.Y; cy < cells.Max.Y; cy++ {
+			for cx := cells.Min.X; cx < cells.Max.X; cx++ {
+				out.SetRGBA(cx, cy, c)
+			}
+		}
+	}
+
+	return out
+}
+
+// blockCells returns the grid cells, stride apart from the region's origin,
+// whose origins lie in block
+func blockCells(region *Region, block image.Rectangle, stride image.Point) image.Rectangle {
+	return image.Rect(
+		ceilDiv(block.Min.X-region.X, stride.X), ceilDiv(block.Min.Y-region.Y, stride.Y),
+		ceilDiv(block.Max.X-region.X, stride.X), ceilDiv(block.Max.Y-region.Y, stride.Y),
+	)
+}
+
+// ceilDiv returns a/b rounded up, for non-negative a and positive b
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// subdivideBlock appends the block to blocks, splitting it into quadrants
+// while its pixel variance exceeds VarianceThreshold and the quadrants are
+// no smaller than MinBlockSize
+func subdivideBlock(blocks []image.Rectangle, img image.Image, region *Region, block image.Rectangle, opts *MosaicOptions) []image.Rectangle {
+	halfW, halfH := block.Dx()/2, block.Dy()/2
+	if min(halfW, halfH) < max(1, opts.MinBlockSize) {
+		return append(blocks, block)
+	}
+
+	pixels := opts.readPixels(img, blockRegion(region, block))
+	if pixelVariance(pixels) <= opts.VarianceThreshold {
+		return append(blocks, block)
+	}
+
+	mid := block.Min.Add(image.Pt(halfW, halfH))
+	quadrants := []image.Rectangle{
+		image.Rect(block.Min.X, block.Min.Y, mid.X, mid.Y),
+		image.Rect(mid.X, block.Min.Y, block.Max.X, mid.Y),
+		image.Rect(block.Min.X, mid.Y, mid.X, block.Max.Y),
+		image.Rect(mid.X, mid.Y, block.Max.X, block.Max.Y),
+	}
+	for _, q := range quadrants {
+		// Quadrants past the region's edge have nothing to paint
+		if q.Overlaps(region.rect()) {
+			blocks = subdivideBlock(blocks, img, region, q, opts)
+		}
+	}
+
+	return blocks
+}
+
+// subdivideByDensity appends the block to blocks, splitting it into quadrants
+// while the quadrants are no smaller than the size the DensityMap asks for at
+// the block's center
+func subdivideByDensity(blocks []image.Rectangle, bounds image.Rectangle, region *Region, block image.Rectangle, opts *MosaicOptions) []image.Rectangle {
+	halfW, halfH := block.Dx()/2, block.Dy()/2
+	minSize := max(1, opts.MinBlockSize)
+	if min(halfW, halfH) < minSize {
+		return append(blocks, block)
+	}
+
+	center := block.Min.Add(block.Max).Div(2)
+	l := densityAt(opts.DensityMap, bounds, center.X, center.Y)
+	dims := opts.blockDims()
+	target := float64(minSize) + l*float64(min(dims.X, dims.Y)-minSize)
+	if float64(min(halfW, halfH)) < target {
+		return append(blocks, block)
+	}
+
+	mid := block.Min.Add(image.Pt(halfW, halfH))
+	quadrants := []image.Rectangle{
+		image.Rect(block.Min.X, block.Min.Y, mid.X, mid.Y),
+		image.Rect(mid.X, block.Min.Y, block.Max.X, mid.Y),
+		image.Rect(block.Min.X, mid.Y, mid.X, block.Max.Y),
+		image.Rect(mid.X, mid.Y, block.Max.X, block.Max.Y),
+	}
+	for _, q := range quadrants {
+		if q.Overlaps(region.rect()) {
+			blocks = subdivideByDensity(blocks, bounds, region, q, opts)
+		}
+	}
+
+	return blocks
+}
+
+// densityAt returns the luminance of the density map at the image point
+// (x, y), stretching the map over the image bounds
+func densityAt(m image.Image, bounds image.Rectangle, x, y int) float64 {
+	mb := m.Bounds()
+	if mb.Empty() || bounds.Empty() {
+		return 1
+	}
+	mx := mb.Min.X + (x-bounds.Min.X)*mb.Dx()/bounds.Dx()
+	my := mb.Min.Y + (y-bounds.Min.Y)*mb.Dy()/bounds.Dy()
+	mx = max(mb.Min.X, min(mx, mb.Max.X-1))
+	my = max(mb.Min.Y, min(my, mb.Max.Y-1))
+	return grayPixel(PixelFromColor(m.At(mx, my))).R
+}
+
+// pixelVariance returns the mean squared distance of pixels from their average
+func pixelVariance(pixels []Pixel) float64 {
+	if len(pixels) == 0 {
+		return 0
+	}
+
+	avg := averagePixels(pixels)
+	var sum float64
+	for _, p := range pixels {
+		d := distance(p, avg)
+		sum += d * d
+	}
+
+	return sum / float64(len(pixels))
+}
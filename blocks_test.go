@@ -0,0 +1,264 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestAdaptiveBlocks(t *testing.T) {
+	// Create test image with a sharp vertical edge at x=40
+	width, height := 64, 64
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 40 {
+				img.Set(x, y, color.RGBA{A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.BlockSize = 16
+	opts.AdaptiveBlocks = true
+	opts.MinBlockSize = 4
+
+	region := &Region{X: 0, Y: 0, Width: width, Height: height}
+	blocks := regionBlocks(img, region, opts)
+
+	blockAt := func(x, y int) image.Rectangle {
+		for _, b := range blocks {
+			if image.Pt(x, y).In(b) {
+				return b
+			}
+		}
+		t.Fatalf("no block covers (%d,%d)", x, y)
+		return image.Rectangle{}
+	}
+
+	tests := []struct {
+		name     string
+		x        int
+		expected int
+	}{
+		{"Flat left half", 8, 16},
+		{"Edge", 40, 8},
+		{"Flat right half", 56, 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockAt(tt.x, 8).Dx(); got != tt.expected {
+				t.Errorf("block size at x=%d = %d, want %d", tt.x, got, tt.expected)
+			}
+		})
+	}
+
+	// The mosaic keeps the edge sharp
+	result := CreateMosaic(img, opts)
+	if got, want := result.At(39, 8), result.At(40, 8); got == want {
+		t.Errorf("pixels on both sides of the edge = %v, want different colors", got)
+	}
+}
+
+func TestCollapseBlocks(t *testing.T) {
+	// Create test image with four colored quadrants, not a multiple of the block size
+	width, height := 45, 25
+	quadrant := func(x, y int) color.RGBA {
+		switch {
+		case x < 20 && y < 10:
+			return color.RGBA{R: 255, A: 255}
+		case y < 10:
+			return color.RGBA{G: 255, A: 255}
+		case x < 20:
+			return color.RGBA{B: 255, A: 255}
+		default:
+			return color.RGBA{R: 255, G: 255, A: 255}
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, quadrant(x, y))
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 4
+	opts.CollapseBlocks = true
+
+	result := CreateMosaic(img, opts)
+
+	if got, want := result.Bounds(), image.Rect(0, 0, 5, 3); got != want {
+		t.Fatalf("bounds = %v, want %v", got, want)
+	}
+
+	for by := 0; by < 3; by++ {
+		for bx := 0; bx < 5; bx++ {
+			want := quadrant(bx*opts.BlockSize, by*opts.BlockSize)
+			if got := result.At(bx, by); got != want {
+				t.Errorf("block (%d,%d) = %v, want %v", bx, by, got, want)
+			}
+		}
+	}
+}
+
+func TestDensityMapBlocks(t *testing.T) {
+	// A density map that darkens from white on the left to black on the
+	// right, at a lower resolution than the image
+	density := image.NewGray(image.Rect(0, 0, 32, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 32; x++ {
+			density.SetGray(x, y, color.Gray{Y: uint8(255 - x*255/31)})
+		}
+	}
+
+	width, height := 192, 64
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	region := &Region{X: 0, Y: 0, Width: width, Height: height}
+
+	opts := DefaultOptions()
+	opts.BlockSize = 16
+	opts.MinBlockSize = 2
+	opts.DensityMap = density
+
+	blocks := regionBlocks(img, region, opts)
+
+	// Average block width in each third of the image
+	var sums, counts [3]int
+	for _, b := range blocks {
+		third := b.Min.X * 3 / width
+		sums[third] += b.Dx()
+		counts[third]++
+	}
+	var avg [3]float64
+	for i := range avg {
+		avg[i] = float64(sums[i]) / float64(counts[i])
+	}
+
+	if !(avg[0] > avg[1] && avg[1] > avg[2]) {
+		t.Errorf("average block sizes by third = %v, want decreasing", avg)
+	}
+	if avg[0] != 16 {
+		t.Errorf("white area block size = %v, want 16", avg[0])
+	}
+}
+
+func TestStripeLayouts(t *testing.T) {
+	// Create test image with a diagonal gradient
+	width, height := 40, 30
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 8), B: 80, A: 255})
+		}
+	}
+	region := &Region{X: 5, Y: 5, Width: 30, Height: 20}
+
+	tests := []struct {
+		name   string
+		layout BlockLayout
+		band   func(i int) image.Rectangle // i-th stripe of the region
+	}{
+		{"horizontal", LayoutHStripe, func(i int) image.Rectangle {
+			return image.Rect(region.X, region.Y+i*5, region.X+region.Width, region.Y+(i+1)*5)
+		}},
+		{"vertical", LayoutVStripe, func(i int) image.Rectangle {
+			return image.Rect(region.X+i*5, region.Y, region.X+(i+1)*5, region.Y+region.Height)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.K = 4
+			opts.BlockSize = 5
+			opts.BlockLayout = tt.layout
+			opts.Region = region
+
+			result := CreateMosaic(img, opts)
+
+			// Every pixel of a stripe shares one color across the region
+			for i := 0; i < 4; i++ {
+				band := tt.band(i)
+				want := result.At(band.Min.X, band.Min.Y)
+				for y := band.Min.Y; y < band.Max.Y; y++ {
+					for x := band.Min.X; x < band.Max.X; x++ {
+						if got := result.At(x, y); got != want {
+							t.Fatalf("stripe %d pixel (%d,%d) = %v, want %v", i, x, y, got, want)
+						}
+					}
+				}
+			}
+
+			// Pixels outside the region are untouched
+			if got, want := result.At(2, 2), img.At(2, 2); got != want {
+				t.Errorf("pixel outside region = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBlockJitter(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	region := &Region{X: 5, Y: 5, Width: 30, Height: 30}
+
+	opts := DefaultOptions()
+	opts.BlockJitter = 6
+	opts.Seed = 1
+
+	// Rows start at different offsets, the same ones for the same seed
+	blocks := regionBlocks(img, region, opts)
+	starts := map[int]int{}
+	for _, b := range blocks {
+		if _, ok := starts[b.Min.Y]; !ok {
+			starts[b.Min.Y] = b.Min.X
+		}
+	}
+	if starts[5] == starts[15] {
+		t.Errorf("rows at y=5 and y=15 both start at x=%d, want different offsets", starts[5])
+	}
+	again := regionBlocks(img, region, opts)
+	for i := range blocks {
+		if blocks[i] != again[i] {
+			t.Fatalf("block %d = %v, then %v with the same seed", i, blocks[i], again[i])
+		}
+	}
+
+	// Every pixel of the region is still covered by exactly one block
+	for y := region.Y; y < region.Y+region.Height; y++ {
+		for x := region.X; x < region.X+region.Width; x++ {
+			n := 0
+			for _, b := range blocks {
+				if image.Pt(x, y).In(b) {
+					n++
+				}
+			}
+			if n != 1 {
+				t.Fatalf("pixel (%d,%d) covered by %d blocks, want 1", x, y, n)
+			}
+		}
+	}
+
+	// Painting follows the jittered grid without leaving the region
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 6), A: 255})
+		}
+	}
+	opts.NoQuantize = true
+	opts.Region = region
+	result := CreateMosaicRGBA(img, opts)
+	for _, b := range blocks {
+		r := b.Intersect(region.rect())
+		want := result.RGBAAt(r.Min.X, r.Min.Y)
+		if got := result.RGBAAt(r.Max.X-1, r.Max.Y-1); got != want {
+			t.Errorf("block %v is not uniform: %v != %v", b, got, want)
+		}
+	}
+	if got, want := result.RGBAAt(4, 10), img.RGBAAt(4, 10); got != want {
+		t.Errorf("pixel left of the region = %v, want original %v", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// blurredImage is an image with one rectangle replaced by blurred pixels
+type blurredImage struct {
+	image.Image
+	rect image.Rectangle
+	pix  []color.RGBA64
+}
+
+// At returns the blurred pixel inside the rectangle and the original outside
+func (b *blurredImage) At(x, y int) color.Color {
+	if !image.Pt(x, y).In(b.rect) {
+		return b.Image.At(x, y)
+	}
+	return b.pix[(y-b.rect.Min.Y)*b.rect.Dx()+(x-b.rect.Min.X)]
+}
+
+// preBlur returns a working copy of img with each region box-blurred by
+// PreBlurRadius, or img itself when the radius is not positive. The blur
+// only reads pixels inside the region, so colors outside it do not bleed in.
+func (opts *MosaicOptions) preBlur(img image.Image, regions []*Region) image.Image {
+	if opts.PreBlurRadius <= 0 {
+		return img
+	}
+	for _, region := range regions {
+		img = boxBlur(img, region.rect(), opts.PreBlurRadius)
+	}
+	return img
+}
+
+// boxBlur returns img with rect replaced by its box blur of the given
+// radius. Premultiplied channels are blurred so that alpha stays consistent,
+// and windows are clipped to rect.
+func boxBlur(img image.Image, rect image.Rectangle, radius int) image.Image {
+	w, h := rect.Dx(), rect.Dy()
+	values := make([][4]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, a := img.At(rect.Min.X+x, rect.Min.Y+y).RGBA()
+			values[y*w+x] = [4]float64{float64(r), float64(g), float64(b), float64(a)}
+		}
+	}
+
+	// Blur rows, then columns
+	blurLines(values, h, w, 1, w, radius)
+	blurLines(values, w, h, w, 1, radius)
+
+	pix := make([]color.RGBA64, len(values))
+	for i, v := range values {
+		pix[i] = color.RGBA64{
+			R: uint16(math.Round(v[0])),
+			G: uint16(math.Round(v[1])),
+			B: uint16(math.Round(v[2])),
+			A: uint16(math.Round(v[3])),
+		}
+	}
+	return &blurredImage{Image: img, rect: rect, pix: pix}
+}
+
+// blurLines box-blurs count lines of length values each in place. Line i
+// starts at index i*lineStep and its values are step apart.
+func blurLines(values [][4]float64, count, length, step, lineStep, radius int) {
+	prefix := make([][4]float64, length+1)
+	for i := 0; i < count; i++ {
+		start := i * lineStep
+		for j := 0; j < length; j++ {
+			v := values[start+j*step]
+			for c := range v {
+				prefix[j+1][c] = prefix[j][c] + v[c]
+			}
+		}
+		for j := 0; j < length; j++ {
+			lo, hi := max(0, j-radius), min(length, j+radius+1)
+			n := float64(hi - lo)
+			for c := 0; c < 4; c++ {
+				values[start+j*step][c] = (prefix[hi][c] - prefix[lo][c]) / n
+			}
+		}
+	}
+}
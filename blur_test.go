@@ -0,0 +1,82 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestPreBlurPalette(t *testing.T) {
+	// A flat gray image with one pixel in ten replaced by random noise
+	rng := rand.New(rand.NewSource(1))
+	width, height := 60, 60
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+			if rng.Intn(10) == 0 {
+				c = color.RGBA{R: uint8(rng.Intn(256)), G: uint8(rng.Intn(256)), B: uint8(rng.Intn(256)), A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	colors := func(radius int) int {
+		opts := DefaultOptions()
+		opts.MergeThreshold = 0.05
+		opts.InitMethod = InitFixedSampling
+		opts.PreBlurRadius = radius
+		return len(ExtractPalette(img, opts))
+	}
+
+	without, with := colors(0), colors(3)
+	if with >= without {
+		t.Errorf("palette has %d colors with PreBlurRadius, %d without, want fewer with", with, without)
+	}
+}
+
+func TestPreBlurRegion(t *testing.T) {
+	// Alternating black and white columns
+	width, height := 40, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x%2 == 0 {
+				img.Set(x, y, color.RGBA{A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+	rect := image.Rect(10, 5, 30, 15)
+
+	blurred := boxBlur(img, rect, 1)
+
+	// Pixels outside the region are unchanged
+	for _, p := range []image.Point{{0, 0}, {9, 7}, {30, 7}, {15, 4}} {
+		if got, want := blurred.At(p.X, p.Y), img.At(p.X, p.Y); !sameRGBA(got, want) {
+			t.Errorf("pixel %v = %v, want original %v", p, got, want)
+		}
+	}
+
+	// Inside, each pixel averages its three-column window: white between two black columns
+	r, _, _, a := blurred.At(15, 10).RGBA()
+	if want := uint32(0xffff / 3); r < want-1 || r > want+1 || a != 0xffff {
+		t.Errorf("blurred pixel = %v, want about %d/%d", blurred.At(15, 10), want, 0xffff)
+	}
+
+	// The region's edge column only averages columns inside the region
+	if r, _, _, _ := blurred.At(10, 10).RGBA(); r != 0x7fff && r != 0x8000 {
+		t.Errorf("edge pixel red = %#x, want half intensity", r)
+	}
+
+	// CreateMosaic keeps the outside of the region untouched
+	opts := DefaultOptions()
+	opts.PreBlurRadius = 2
+	opts.Region = &Region{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}
+	result := CreateMosaic(img, opts)
+	if got, want := result.At(5, 5), img.At(5, 5); !sameRGBA(got, want) {
+		t.Errorf("pixel outside region = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+package mosaic
+
+// centroidCache remembers the nearest centroid for block averages quantized
+// to a few bits per channel. A nil cache computes every lookup exactly.
+type centroidCache struct {
+	levels  float64
+	nearest map[uint64]int
+}
+
+// newCentroidCache returns a cache keyed by bits per channel, or nil when
+// bits is not positive
+func newCentroidCache(bits int) *centroidCache {
+	if bits <= 0 {
+		return nil
+	}
+	bits = min(bits, 16)
+	return &centroidCache{
+		levels:  float64(int(1)<<bits - 1),
+		nearest: make(map[uint64]int),
+	}
+}
+
+// nearestIndex returns the index of the centroid nearest to p as found by
+// nearest, reusing the result for earlier colors with the same quantized key
+func (c *centroidCache) nearestIndex(p Pixel, nearest func(Pixel) int) int {
+	if c == nil {
+		return nearest(p)
+	}
+
+	key := c.quantize(p.R)<<32 | c.quantize(p.G)<<16 | c.quantize(p.B)
+	if idx, ok := c.nearest[key]; ok {
+		return idx
+	}
+	idx := nearest(p)
+	c.nearest[key] = idx
+	return idx
+}
+
+// quantize maps a channel value to its cache level
+func (c *centroidCache) quantize(v float64) uint64 {
+	return uint64(clamp01(v)*c.levels + 0.5)
+}
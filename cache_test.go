@@ -0,0 +1,80 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCentroidCache(t *testing.T) {
+	centroids := []Pixel{{R: 0.1, G: 0.1, B: 0.1}, {R: 0.9, G: 0.9, B: 0.9}}
+
+	// A nil cache is exact
+	var exact *centroidCache
+	if got := exact.nearestIndex(Pixel{R: 0.8, G: 0.8, B: 0.8}, (&MosaicOptions{}).nearestCentroidFunc(centroids, distanceSquared)); got != 1 {
+		t.Errorf("nil cache nearestIndex() = %d, want 1", got)
+	}
+
+	calls := 0
+	counting := func(p1, p2 Pixel) float64 {
+		calls++
+		return distanceSquared(p1, p2)
+	}
+
+	nearest := (&MosaicOptions{}).nearestCentroidFunc(centroids, counting)
+	cache := newCentroidCache(5)
+	first := cache.nearestIndex(Pixel{R: 0.2, G: 0.2, B: 0.2}, nearest)
+	afterFirst := calls
+	second := cache.nearestIndex(Pixel{R: 0.201, G: 0.2, B: 0.2}, nearest)
+
+	if first != 0 || second != 0 {
+		t.Errorf("nearestIndex() = %d, %d, want 0, 0", first, second)
+	}
+	if calls != afterFirst {
+		t.Errorf("cached lookup computed %d distances, want 0", calls-afterFirst)
+	}
+}
+
+func BenchmarkCentroidCache(b *testing.B) {
+	// A screenshot-like image of large flat panels
+	width, height := 512, 512
+	panels := []color.RGBA{
+		{R: 240, G: 240, B: 240, A: 255},
+		{R: 30, G: 30, B: 40, A: 255},
+		{R: 50, G: 120, B: 200, A: 255},
+		{R: 200, G: 60, B: 50, A: 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, panels[(x/128+y/64)%len(panels)])
+		}
+	}
+	region := &Region{X: 0, Y: 0, Width: width, Height: height}
+
+	for _, bits := range []int{0, 5} {
+		name := "Off"
+		if bits > 0 {
+			name = "5Bits"
+		}
+		b.Run(name, func(b *testing.B) {
+			opts := DefaultOptions()
+			opts.BlockSize = 4
+			opts.CentroidCacheBits = bits
+			centroids, _ := kmeans(opts.readPixels(img, region), opts)
+			rects := regionBlocks(img, region, opts)
+
+			calls := 0
+			counting := func(p1, p2 Pixel) float64 {
+				calls++
+				return distanceSquared(p1, p2)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				planRegion(img, region, rects, centroids, counting, opts, nil)
+			}
+			b.ReportMetric(float64(calls)/float64(b.N), "distances/op")
+		})
+	}
+}
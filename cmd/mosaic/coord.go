@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseCoord parses a region coordinate given either in pixels ("100") or
+// as a percentage of size ("25%", "12.5%"), returning pixels
+func parseCoord(s string, size int) (int, error) {
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid percentage %q", s)
+		}
+		return int(math.Round(float64(size) * p / 100)), nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid coordinate %q (use pixels or a percentage such as 25%%)", s)
+	}
+	return n, nil
+}
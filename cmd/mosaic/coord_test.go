@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestParseCoord(t *testing.T) {
+	tests := []struct {
+		s        string
+		size     int
+		expected int
+		wantErr  bool
+	}{
+		{"50%", 200, 100, false},
+		{"100", 200, 100, false},
+		{"12.5%", 80, 10, false},
+		{"100%", 37, 37, false},
+		{"-1", 200, -1, false},
+		{"50px", 200, 0, true},
+		{"%", 200, 0, true},
+		{"", 200, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseCoord(tt.s, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCoord(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("parseCoord(%q, %d) = %d, want %d", tt.s, tt.size, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// processDir mosaics every image in the input directory, and with recursive
+// in its subdirectories, into the output directory under the same relative
+// path with the extension of format. Files that are not images are skipped
+// and reported without stopping the batch. It returns the exit code, which
+// is non-zero when an image could not be written.
+func processDir(input, output string, recursive bool, format string, quality int, cfg *settings, stdout, stderr io.Writer) int {
+	outputAbs, _ := filepath.Abs(output)
+	failed := false
+
+	err := filepath.WalkDir(input, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Do not descend into subdirectories, or into our own output
+			abs, _ := filepath.Abs(path)
+			if path != input && (!recursive || abs == outputAbs) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		img, err := decodeFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "Skipping %s: %v\n", path, err)
+			return nil
+		}
+
+		rel, err := filepath.Rel(input, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(output, strings.TrimSuffix(rel, filepath.Ext(rel))+formatExtension(format))
+
+		mosaicImg, err := cfg.mosaic(img, stderr)
+		if err == nil {
+			err = writeImage(dst, mosaicImg, format, quality)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s: %v\n", path, err)
+			failed = true
+			return nil
+		}
+
+		fmt.Fprintln(stdout, "Mosaic image created successfully:", dst)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: could not read input directory: %v\n", err)
+		return 1
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// decodeFile decodes the image in a file, sniffing its format
+func decodeFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
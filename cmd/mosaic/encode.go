@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// outputFormat returns the image format for an output path based on its extension
+func outputFormat(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".png":
+		return "png", nil
+	case ".jpg", ".jpeg":
+		return "jpeg", nil
+	case ".gif":
+		return "gif", nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q (use .png, .jpg, .jpeg or .gif)", ext)
+	}
+}
+
+// resolveFormat returns the output format, taken from the format flag when
+// writing to stdout and from the file extension otherwise
+func resolveFormat(output, format string) (string, error) {
+	if output != stdio {
+		return outputFormat(output)
+	}
+
+	switch format = strings.ToLower(format); format {
+	case "png", "jpeg", "gif":
+		return format, nil
+	case "jpg":
+		return "jpeg", nil
+	case "":
+		return "", fmt.Errorf("-format is required when writing to stdout")
+	default:
+		return "", fmt.Errorf("unsupported output format %q (use png, jpeg or gif)", format)
+	}
+}
+
+// dirFormat returns the output format for a directory of images, taken from
+// the format flag and defaulting to PNG
+func dirFormat(format string) (string, error) {
+	if format == "" {
+		return "png", nil
+	}
+	return resolveFormat(stdio, format)
+}
+
+// formatExtension returns the file extension for an output format
+func formatExtension(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// encodeImage writes img to w in the given format.
+// quality (1-100) is only used for JPEG output.
+func encodeImage(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case "png":
+		return png.Encode(w, img)
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case "gif":
+		return gif.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+}
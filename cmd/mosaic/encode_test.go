@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+		wantErr  bool
+	}{
+		{"out.png", "png", false},
+		{"out.jpg", "jpeg", false},
+		{"out.JPEG", "jpeg", false},
+		{"out.gif", "gif", false},
+		{"out.bmp", "", true},
+		{"out", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := outputFormat(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outputFormat(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("outputFormat(%q) = %q, want %q", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	// Create test image
+	width, height := 16, 8
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), B: uint8(y * 32), A: 255})
+		}
+	}
+
+	for _, format := range []string{"png", "jpeg", "gif"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeImage(&buf, img, format, 90); err != nil {
+				t.Fatalf("encodeImage() error = %v", err)
+			}
+
+			decoded, got, err := image.Decode(&buf)
+			if err != nil {
+				t.Fatalf("image.Decode() error = %v", err)
+			}
+			if got != format {
+				t.Errorf("decoded format = %q, want %q", got, format)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Errorf("decoded bounds = %v, want %v", decoded.Bounds(), img.Bounds())
+			}
+		})
+	}
+}
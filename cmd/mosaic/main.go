@@ -4,66 +4,188 @@ import (
 	"flag"
 	"fmt"
 	"image"
-	"image/png"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/kohge4/mosaic-image"
+
+	// Register the WebP decoder for input images. The library itself stays
+	// free of dependencies.
+	_ "golang.org/x/image/webp"
 )
 
+// stdio is the path that selects stdin for -input and stdout for -output
+const stdio = "-"
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the CLI with the given arguments and streams and returns the
+// process exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mosaic", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
 	// Parse command line arguments
-	input := flag.String("input", "", "Path to input image (required)")
-	output := flag.String("output", "", "Path to output image (required)")
-	k := flag.Int("k", 8, "Number of colors to use")
-	blockSize := flag.Int("block", 10, "Size of mosaic blocks in pixels")
-	iterations := flag.Int("iterations", 50, "Maximum number of k-means iterations")
-	tolerance := flag.Float64("tolerance", 0.001, "Convergence tolerance for k-means")
+	input := flags.String("input", "", "Path to input image or directory, or - for stdin (required)")
+	output := flags.String("output", "", "Path to output image or directory, or - for stdout (required)")
+	formatFlag := flags.String("format", "", "Output format when writing to stdout or a directory (png, jpeg or gif)")
+	recursive := flags.Bool("recursive", false, "Also process images in subdirectories of an input directory")
+	quality := flags.Int("quality", 90, "JPEG output quality (1-100)")
 
-	// Region options
-	x := flag.Int("x", -1, "X-coordinate of top-left corner for mosaic region (-1 for entire width)")
-	y := flag.Int("y", -1, "Y-coordinate of top-left corner for mosaic region (-1 for entire height)")
-	width := flag.Int("width", -1, "Width of mosaic region (-1 for remaining width)")
-	height := flag.Int("height", -1, "Height of mosaic region (-1 for remaining height)")
+	var cfg settings
+	flags.IntVar(&cfg.k, "k", 8, "Number of colors to use")
+	flags.IntVar(&cfg.blockSize, "block", 10, "Size of mosaic blocks in pixels")
+	flags.IntVar(&cfg.iterations, "iterations", 50, "Maximum number of k-means iterations")
+	flags.Float64Var(&cfg.tolerance, "tolerance", 0.001, "Convergence tolerance for k-means")
+	flags.BoolVar(&cfg.palette, "palette", false, "Print the extracted palette as #rrggbb lines to stderr, most common first")
 
-	flag.Parse()
+	// Region options, in pixels or as a percentage of the image size
+	flags.StringVar(&cfg.x, "x", "-1", "X-coordinate of top-left corner for mosaic region, in pixels or % of width (-1 for entire width)")
+	flags.StringVar(&cfg.y, "y", "-1", "Y-coordinate of top-left corner for mosaic region, in pixels or % of height (-1 for entire height)")
+	flags.StringVar(&cfg.width, "width", "-1", "Width of mosaic region, in pixels or % of width (-1 for remaining width)")
+	flags.StringVar(&cfg.height, "height", "-1", "Height of mosaic region, in pixels or % of height (-1 for remaining height)")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
 
 	// Check required parameters
 	if *input == "" || *output == "" {
-		fmt.Println("Error: input and output paths are required")
-		flag.Usage()
-		os.Exit(1)
+		fmt.Fprintln(stderr, "Error: input and output paths are required")
+		flags.Usage()
+		return 1
+	}
+	if err := cfg.options().Validate(); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// A directory input is processed image by image into an output directory
+	if info, err := os.Stat(*input); *input != stdio && err == nil && info.IsDir() {
+		if *output == stdio {
+			fmt.Fprintln(stderr, "Error: output must be a directory when input is a directory")
+			return 1
+		}
+		format, err := dirFormat(*formatFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		if *quality < 1 || *quality > 100 {
+			fmt.Fprintln(stderr, "Error: quality must be between 1 and 100")
+			return 1
+		}
+		return processDir(*input, *output, *recursive, format, *quality, &cfg, stdout, stderr)
+	}
+
+	// Determine output format from -format for stdout, or the file extension
+	format, err := resolveFormat(*output, *formatFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *quality < 1 || *quality > 100 {
+		fmt.Fprintln(stderr, "Error: quality must be between 1 and 100")
+		return 1
 	}
 
 	// Open input image
-	file, err := os.Open(*input)
+	in := stdin
+	if *input != stdio {
+		file, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: could not open input image: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+
+	// Decode image, sniffing the format from its contents
+	img, _, err := image.Decode(in)
 	if err != nil {
-		fmt.Printf("Error: could not open input image: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Error: could not decode image: %v\n", err)
+		return 1
 	}
-	defer file.Close()
 
-	// Decode image
-	img, _, err := image.Decode(file)
+	mosaicImg, err := cfg.mosaic(img, stderr)
 	if err != nil {
-		fmt.Printf("Error: could not decode image: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Write to stdout without a success message, which would corrupt the image
+	if *output == stdio {
+		if err := encodeImage(stdout, mosaicImg, format, *quality); err != nil {
+			fmt.Fprintf(stderr, "Error: could not save image: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := writeImage(*output, mosaicImg, format, *quality); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
 	}
 
-	// Configure mosaic options
+	fmt.Fprintln(stdout, "Mosaic image created successfully:", *output)
+	return 0
+}
+
+// settings holds the flags that configure the mosaic of each image
+type settings struct {
+	k, blockSize, iterations int
+	tolerance                float64
+	palette                  bool
+	x, y, width, height      string // region coordinates, in pixels or percent
+}
+
+// options returns the mosaic options set by the flags, without the region
+func (cfg *settings) options() *mosaic.MosaicOptions {
 	opts := mosaic.DefaultOptions()
-	opts.K = *k
-	opts.BlockSize = *blockSize
-	opts.Iterations = *iterations
-	opts.Tolerance = *tolerance
+	opts.K = cfg.k
+	opts.BlockSize = cfg.blockSize
+	opts.Iterations = cfg.iterations
+	opts.Tolerance = cfg.tolerance
+	return opts
+}
 
-	// Configure region if specified
+// mosaic creates the mosaic of img, printing its palette to stderr when
+// requested
+func (cfg *settings) mosaic(img image.Image, stderr io.Writer) (image.Image, error) {
+	opts := cfg.options()
+
+	// Convert region coordinates to pixels
 	bounds := img.Bounds()
-	if *x >= 0 && *y >= 0 {
-		regionX := *x
-		regionY := *y
-		regionWidth := *width
-		regionHeight := *height
+	var coords [4]int
+	for i, c := range []struct {
+		value string
+		size  int
+	}{
+		{cfg.x, bounds.Dx()},
+		{cfg.y, bounds.Dy()},
+		{cfg.width, bounds.Dx()},
+		{cfg.height, bounds.Dy()},
+	} {
+		var err error
+		if coords[i], err = parseCoord(c.value, c.size); err != nil {
+			return nil, err
+		}
+	}
+
+	// Configure region if specified
+	if coords[0] >= 0 && coords[1] >= 0 {
+		regionX := coords[0]
+		regionY := coords[1]
+		regionWidth := coords[2]
+		regionHeight := coords[3]
 
 		// Use remaining width/height if not specified
 		if regionWidth < 0 {
@@ -81,27 +203,56 @@ func main() {
 		}
 	}
 
-	// Create output directory if needed
-	if err := os.MkdirAll(filepath.Dir(*output), 0755); err != nil {
-		fmt.Printf("Error: could not create output directory: %v\n", err)
-		os.Exit(1)
+	// Generate mosaic image
+	mosaicImg, stats := mosaic.CreateMosaicWithStats(img, opts)
+
+	// Print the palette to stderr, keeping stdout clean for the image
+	if cfg.palette {
+		printPalette(stderr, stats)
+	}
+
+	return mosaicImg, nil
+}
+
+// printPalette writes the colors that painted the mosaic as #rrggbb lines,
+// most common first. Clusters no pixel was assigned to are skipped.
+func printPalette(w io.Writer, stats *mosaic.MosaicStats) {
+	order := make([]int, 0, len(stats.Palette))
+	for i := range stats.Palette {
+		if len(stats.ClusterSizes) != len(stats.Palette) || stats.ClusterSizes[i] > 0 {
+			order = append(order, i)
+		}
+	}
+	if len(stats.ClusterSizes) == len(stats.Palette) {
+		sort.SliceStable(order, func(a, b int) bool {
+			return stats.ClusterSizes[order[a]] > stats.ClusterSizes[order[b]]
+		})
+	}
+
+	for _, i := range order {
+		c := stats.Palette[i]
+		fmt.Fprintf(w, "#%02x%02x%02x\n", c.R, c.G, c.B)
 	}
+}
 
-	// Generate mosaic image
-	mosaicImg := mosaic.CreateMosaic(img, opts)
+// writeImage saves img to a file in the given format, creating its
+// directory if needed
+func writeImage(path string, img image.Image, format string, quality int) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
 
-	// Save result
-	outFile, err := os.Create(*output)
+	file, err := os.Create(path)
 	if err != nil {
-		fmt.Printf("Error: could not create output file: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("could not create output file: %w", err)
 	}
-	defer outFile.Close()
 
-	if err := png.Encode(outFile, mosaicImg); err != nil {
-		fmt.Printf("Error: could not save image: %v\n", err)
-		os.Exit(1)
+	if err := encodeImage(file, img, format, quality); err != nil {
+		file.Close()
+		return fmt.Errorf("could not save image: %w", err)
 	}
-
-	fmt.Println("Mosaic image created successfully:", *output)
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not save image: %w", err)
+	}
+	return nil
 }
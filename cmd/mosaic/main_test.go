@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gopherWebP is a small lossless WebP image
+//
+//go:embed testdata/gopher.webp
+var gopherWebP []byte
+
+// testPNG returns a small encoded PNG with two colored halves
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 10 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRunStdio(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"png", "png"},
+		{"jpeg", "jpeg"},
+		{"jpg", "jpeg"},
+		{"gif", "gif"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := []string{"-input", "-", "-output", "-", "-format", tt.format, "-k", "2", "-block", "5"}
+			if code := run(args, bytes.NewReader(testPNG(t)), &stdout, &stderr); code != 0 {
+				t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+			}
+
+			img, got, err := image.Decode(&stdout)
+			if err != nil {
+				t.Fatalf("image.Decode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("decoded format = %q, want %q", got, tt.want)
+			}
+			if img.Bounds() != image.Rect(0, 0, 20, 10) {
+				t.Errorf("bounds = %v, want %v", img.Bounds(), image.Rect(0, 0, 20, 10))
+			}
+		})
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	output := filepath.Join(dir, "out", "out.png")
+	if err := os.WriteFile(input, testPNG(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-input", input, "-output", output}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("output not written: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "created successfully") {
+		t.Errorf("stdout = %q, want success message", stdout.String())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing paths", []string{"-input", "-"}},
+		{"stdout without format", []string{"-input", "-", "-output", "-"}},
+		{"unsupported format", []string{"-input", "-", "-output", "-", "-format", "bmp"}},
+		{"bad quality", []string{"-input", "-", "-output", "-", "-format", "jpeg", "-quality", "0"}},
+		{"bad k", []string{"-input", "-", "-output", "-", "-format", "png", "-k", "0"}},
+		{"negative tolerance", []string{"-input", "-", "-output", "-", "-format", "png", "-tolerance", "-1"}},
+		{"bad coordinate", []string{"-input", "-", "-output", "-", "-format", "png", "-x", "50px", "-y", "0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, bytes.NewReader(testPNG(t)), &stdout, &stderr); code == 0 {
+				t.Errorf("run() = 0, want failure")
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("stdout = %q, want empty", stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunWebPInput(t *testing.T) {
+	src, format, err := image.Decode(bytes.NewReader(gopherWebP))
+	if err != nil {
+		t.Fatalf("image.Decode() error = %v", err)
+	}
+	if format != "webp" {
+		t.Fatalf("decoded format = %q, want webp", format)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-input", "-", "-output", "-", "-format", "png", "-k", "2"}
+	if code := run(args, bytes.NewReader(gopherWebP), &stdout, &stderr); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+
+	img, err := png.Decode(&stdout)
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	if img.Bounds() != src.Bounds() {
+		t.Errorf("bounds = %v, want %v", img.Bounds(), src.Bounds())
+	}
+}
+
+func TestRunPalette(t *testing.T) {
+	// testPNG is red on the left half and blue on the right
+	var stdout, stderr bytes.Buffer
+	args := []string{"-input", "-", "-output", "-", "-format", "png", "-k", "2", "-palette"}
+	if code := run(args, bytes.NewReader(testPNG(t)), &stdout, &stderr); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+
+	lines := strings.Fields(stderr.String())
+	if len(lines) != 2 {
+		t.Fatalf("palette lines = %q, want 2 colors", lines)
+	}
+	got := map[string]bool{lines[0]: true, lines[1]: true}
+	for _, want := range []string{"#ff0000", "#0000ff"} {
+		if !got[want] {
+			t.Errorf("palette lines = %q, want %s", lines, want)
+		}
+	}
+
+	// The image on stdout is untouched by the palette and painted with
+	// exactly the printed colors
+	img, err := png.Decode(&stdout)
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	painted := map[string]bool{}
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			painted[fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)] = true
+		}
+	}
+	if len(painted) != len(got) {
+		t.Errorf("image colors = %v, want the printed palette %q", painted, lines)
+	}
+	for c := range painted {
+		if !got[c] {
+			t.Errorf("image color %s missing from printed palette %q", c, lines)
+		}
+	}
+}
+
+func TestRunPercentRegion(t *testing.T) {
+	// Mosaic only the right half of an image with a red-to-blue gradient
+	img := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(255 - x*12), B: uint8(x * 12), A: 255})
+		}
+	}
+	var in bytes.Buffer
+	if err := png.Encode(&in, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-input", "-", "-output", "-", "-format", "png", "-x", "50%", "-y", "0", "-width", "50%", "-block", "5"}
+	if code := run(args, &in, &stdout, &stderr); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+	result, err := png.Decode(&stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The left half is untouched and the right half is mosaicked
+	for x := 0; x < 10; x++ {
+		if got, want := color.RGBAModel.Convert(result.At(x, 0)), img.At(x, 0); got != want {
+			t.Errorf("pixel (%d,0) = %v, want original %v", x, got, want)
+		}
+	}
+	if result.At(10, 0) != result.At(11, 0) {
+		t.Errorf("pixels in the region differ: %v != %v", result.At(10, 0), result.At(11, 0))
+	}
+}
+
+func TestRunDirectory(t *testing.T) {
+	// Two images, a non-image file and an image in a subdirectory
+	input := t.TempDir()
+	files := map[string][]byte{
+		"a.png":      testPNG(t),
+		"b.png":      testPNG(t),
+		"notes.txt":  []byte("not an image"),
+		"sub/c.webp": gopherWebP,
+	}
+	for name, data := range files {
+		path := filepath.Join(input, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"flat", nil, []string{"a.png", "b.png"}},
+		{"recursive", []string{"-recursive", "-format", "jpeg"}, []string{"a.jpg", "b.jpg", "sub/c.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := t.TempDir()
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-input", input, "-output", output, "-k", "2"}, tt.args...)
+			if code := run(args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+			}
+
+			var got []string
+			filepath.WalkDir(output, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					rel, _ := filepath.Rel(output, path)
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("outputs = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(stderr.String(), "Skipping") || !strings.Contains(stderr.String(), "notes.txt") {
+				t.Errorf("stderr = %q, want notes.txt reported as skipped", stderr.String())
+			}
+		})
+	}
+
+	// A directory cannot be written to stdout
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-input", input, "-output", "-"}, nil, &stdout, &stderr); code == 0 {
+		t.Errorf("run() with stdout output = 0, want failure")
+	}
+}
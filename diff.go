@@ -0,0 +1,36 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// DiffImage creates the mosaic of img like CreateMosaic and also returns a
+// grayscale map of how far each mosaic pixel is from the original, by the
+// color distance configured with DistanceWeights, from black (unchanged) to
+// white (the largest possible distance). Bright areas show where K or
+// BlockSize lose the most detail. CollapseBlocks is ignored so the two
+// images line up.
+func DiffImage(img image.Image, opts *MosaicOptions) (mosaic image.Image, diff *image.Gray) {
+	opts = opts.Normalize()
+	opts.CollapseBlocks = false
+
+	mosaic = CreateMosaic(img, opts)
+
+	dist := opts.distanceFunc()
+	w := opts.DistanceWeights
+	maxDist := math.Sqrt(w[0] + w[1] + w[2])
+
+	bounds := img.Bounds()
+	diff = image.NewGray(bounds)
+	original, painted := pixelReader(img), pixelReader(mosaic)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			d := math.Sqrt(dist(original(x, y), painted(x, y))) / maxDist
+			diff.SetGray(x, y, color.Gray{Y: uint8(clamp01(d)*255 + 0.5)})
+		}
+	}
+
+	return mosaic, diff
+}
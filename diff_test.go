@@ -0,0 +1,52 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDiffImage(t *testing.T) {
+	// A flat left half and a fine checkerboard on the right half, which
+	// blocks cannot reproduce
+	width, height := 40, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 200, G: 80, B: 40, A: 255}
+			if x >= 20 && (x+y)%2 == 0 {
+				c = color.RGBA{A: 255}
+			} else if x >= 20 {
+				c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 3
+	opts.InitMethod = InitFixedSampling
+
+	mosaic, diff := DiffImage(img, opts)
+	if diff.Bounds() != img.Bounds() || mosaic.Bounds() != img.Bounds() {
+		t.Fatalf("bounds = %v and %v, want %v", mosaic.Bounds(), diff.Bounds(), img.Bounds())
+	}
+
+	// mean returns the mean diff intensity over a rectangle
+	mean := func(r image.Rectangle) float64 {
+		sum := 0
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				sum += int(diff.GrayAt(x, y).Y)
+			}
+		}
+		return float64(sum) / float64(r.Dx()*r.Dy())
+	}
+
+	if flat := mean(image.Rect(0, 0, 20, 20)); flat > 1 {
+		t.Errorf("mean diff of the flat half = %.1f, want near 0", flat)
+	}
+	if busy := mean(image.Rect(20, 0, 40, 20)); busy < 50 {
+		t.Errorf("mean diff of the checkerboard = %.1f, want large", busy)
+	}
+}
@@ -0,0 +1,43 @@
+package mosaic
+
+import "image"
+
+// ditherBuffer carries Floyd–Steinberg quantization error between the blocks
+// of a regular grid, keyed by block origin
+type ditherBuffer struct {
+	stride image.Point
+	errs   map[image.Point]Pixel
+}
+
+// newDitherBuffer returns a buffer for a grid whose blocks are stride apart
+func newDitherBuffer(stride image.Point) *ditherBuffer {
+	return &ditherBuffer{stride: stride, errs: make(map[image.Point]Pixel)}
+}
+
+// adjust returns c plus the error diffused to the block at origin so far
+func (d *ditherBuffer) adjust(origin image.Point, c Pixel) Pixel {
+	e := d.errs[origin]
+	delete(d.errs, origin)
+	return Pixel{R: c.R + e.R, G: c.G + e.G, B: c.B + e.B}
+}
+
+// diffuse spreads the error between the wanted and chosen colors of the block
+// at origin over its right and lower neighbors. Blocks must be visited in
+// scan order.
+func (d *ditherBuffer) diffuse(origin image.Point, want, got Pixel) {
+	e := Pixel{R: want.R - got.R, G: want.G - got.G, B: want.B - got.B}
+	s := d.stride
+	d.add(origin.Add(image.Pt(s.X, 0)), e, 7.0/16)
+	d.add(origin.Add(image.Pt(-s.X, s.Y)), e, 3.0/16)
+	d.add(origin.Add(image.Pt(0, s.Y)), e, 5.0/16)
+	d.add(origin.Add(image.Pt(s.X, s.Y)), e, 1.0/16)
+}
+
+// add accumulates weight*e into the error of the block at origin
+func (d *ditherBuffer) add(origin image.Point, e Pixel, weight float64) {
+	acc := d.errs[origin]
+	acc.R += e.R * weight
+	acc.G += e.G * weight
+	acc.B += e.B * weight
+	d.errs[origin] = acc
+}
@@ -0,0 +1,42 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDither(t *testing.T) {
+	// Create a horizontal black-to-white gradient
+	width, height := 200, 60
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(x * 255 / (width - 1))
+			img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	// columnColors sums the distinct block colors used in each block column
+	columnColors := func(dither bool) int {
+		opts := DefaultOptions()
+		opts.K = 3
+		opts.Dither = dither
+		result := CreateMosaic(img, opts)
+
+		total := 0
+		for x := opts.BlockSize / 2; x < width; x += opts.BlockSize {
+			colors := make(map[color.Color]bool)
+			for y := opts.BlockSize / 2; y < height; y += opts.BlockSize {
+				colors[result.At(x, y)] = true
+			}
+			total += len(colors)
+		}
+		return total
+	}
+
+	plain, dithered := columnColors(false), columnColors(true)
+	if dithered <= plain {
+		t.Errorf("dithered column colors = %d, want more than %d without dithering", dithered, plain)
+	}
+}
@@ -0,0 +1,62 @@
+package mosaic
+
+import "image"
+
+// tinyBlockSize is the largest block width and height whose averages are
+// computed by downscaling the whole region in one pass. Reading each tiny
+// block separately costs far more than the pixels it covers.
+const tinyBlockSize = 4
+
+// blockAverages holds the average color of each cell of a block grid laid
+// out from origin, as computed by box-downscaling a region
+type blockAverages struct {
+	origin image.Point
+	dims   image.Point
+	cols   int
+	avgs   []Pixel
+}
+
+// newBlockAverages box-downscales the region to one pixel per block. It
+// returns nil unless blocks form a plain grid of tiny, averaged blocks, in
+// which case each average equals averagePixels of the block's readPixels.
+func newBlockAverages(img image.Image, region *Region, opts *MosaicOptions) *blockAverages {
+	dims := opts.blockDims()
+	if opts.BlockLayout != LayoutGrid || dims.X > tinyBlockSize || dims.Y > tinyBlockSize || opts.blockStride() != dims || opts.variableBlocks() || opts.BlockSample != SampleAverage || opts.IgnoreTransparent || opts.BlockJitter > 0 {
+		return nil
+	}
+
+	cols, rows := ceilDiv(region.Width, dims.X), ceilDiv(region.Height, dims.Y)
+	sums := make([]Pixel, cols*rows)
+	counts := make([]int, cols*rows)
+	pixelAt := pixelReader(img)
+	for y := region.Y; y < region.Y+region.Height; y++ {
+		row := (y - region.Y) / dims.Y * cols
+		for x := region.X; x < region.X+region.Width; x++ {
+			if inAnyRect(x, y, opts.PreserveBoxes) || !region.contains(x, y) {
+				continue
+			}
+			p := opts.convertPixel(pixelAt(x, y))
+			cell := row + (x-region.X)/dims.X
+			sums[cell].R += p.R
+			sums[cell].G += p.G
+			sums[cell].B += p.B
+			counts[cell]++
+		}
+	}
+
+	avgs := make([]Pixel, len(sums))
+	for i, n := range counts {
+		if n > 0 {
+			avgs[i] = Pixel{R: sums[i].R / float64(n), G: sums[i].G / float64(n), B: sums[i].B / float64(n)}
+		}
+	}
+
+	return &blockAverages{origin: image.Pt(region.X, region.Y), dims: dims, cols: cols, avgs: avgs}
+}
+
+// at returns the average color of the block whose top-left corner is at
+// rect.Min
+func (a *blockAverages) at(rect image.Rectangle) Pixel {
+	cell := rect.Min.Sub(a.origin)
+	return a.avgs[cell.Y/a.dims.Y*a.cols+cell.X/a.dims.X]
+}
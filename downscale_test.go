@@ -0,0 +1,116 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// noiseImage returns an image of pseudo-random colors
+func noiseImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 37 % 256), G: uint8(y * 91 % 256), B: uint8((x*y + 13) % 256), A: 255})
+		}
+	}
+	return img
+}
+
+func TestBlockAverages(t *testing.T) {
+	img := noiseImage(37, 23)
+
+	tests := []struct {
+		name   string
+		modify func(opts *MosaicOptions)
+		region *Region
+	}{
+		{"single pixel blocks", func(opts *MosaicOptions) { opts.BlockSize = 1 }, nil},
+		{"partial edge blocks", func(opts *MosaicOptions) { opts.BlockSize = 3 }, &Region{X: 2, Y: 1, Width: 30, Height: 20}},
+		{"rectangular blocks", func(opts *MosaicOptions) { opts.BlockWidth, opts.BlockHeight = 4, 2 }, nil},
+		{"preserved box", func(opts *MosaicOptions) {
+			opts.BlockSize = 2
+			opts.PreserveBoxes = []image.Rectangle{image.Rect(5, 5, 12, 9)}
+		}, nil},
+		{"grayscale", func(opts *MosaicOptions) {
+			opts.BlockSize = 2
+			opts.Grayscale = true
+		}, nil},
+		{"rotated region", func(opts *MosaicOptions) { opts.BlockSize = 2 }, &Region{X: 5, Y: 5, Width: 20, Height: 10, Angle: 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(opts)
+			region := resolveRegion(img.Bounds(), tt.region)
+
+			averages := newBlockAverages(img, region, opts)
+			if averages == nil {
+				t.Fatal("newBlockAverages() = nil, want fast path")
+			}
+
+			// Downscaled averages match averaging each block separately
+			for _, rect := range regionBlocks(img, region, opts) {
+				want := averagePixels(opts.readPixels(img, blockRegion(region, rect)))
+				if got := averages.at(rect); got != want {
+					t.Fatalf("average of %v = %v, want %v", rect, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockAveragesGated(t *testing.T) {
+	img := noiseImage(20, 20)
+	region := resolveRegion(img.Bounds(), nil)
+
+	tests := []struct {
+		name   string
+		modify func(opts *MosaicOptions)
+	}{
+		{"large blocks", func(opts *MosaicOptions) { opts.BlockSize = 10 }},
+		{"overlapping blocks", func(opts *MosaicOptions) {
+			opts.BlockSize = 4
+			opts.BlockStride = 2
+		}},
+		{"adaptive blocks", func(opts *MosaicOptions) {
+			opts.BlockSize = 4
+			opts.AdaptiveBlocks = true
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(opts)
+			if newBlockAverages(img, region, opts) != nil {
+				t.Error("newBlockAverages() != nil, want loop fallback")
+			}
+		})
+	}
+}
+
+func BenchmarkBlockAverages(b *testing.B) {
+	img := noiseImage(256, 256)
+	region := resolveRegion(img.Bounds(), nil)
+	opts := DefaultOptions()
+	opts.BlockSize = 1
+	rects := regionBlocks(img, region, opts)
+
+	b.Run("Loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, rect := range rects {
+				averagePixels(opts.readPixels(img, blockRegion(region, rect)))
+			}
+		}
+	})
+	b.Run("Downscale", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			averages := newBlockAverages(img, region, opts)
+			for _, rect := range rects {
+				averages.at(rect)
+			}
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// drawEdges paints pixels of the region whose Sobel gradient magnitude in the
+// original image exceeds threshold with the edge color
+func drawEdges(mosaic draw.Image, img image.Image, region *Region, threshold float64, c color.Color) {
+	for y := region.Y; y < region.Y+region.Height; y++ {
+		for x := region.X; x < region.X+region.Width; x++ {
+			if sobelMagnitude(img, x, y) > threshold {
+				mosaic.Set(x, y, c)
+			}
+		}
+	}
+}
+
+// hasEdge reports whether any pixel of the region has a Sobel gradient
+// magnitude above threshold
+func hasEdge(img image.Image, region *Region, threshold float64) bool {
+	for y := region.Y; y < region.Y+region.Height; y++ {
+		for x := region.X; x < region.X+region.Width; x++ {
+			if sobelMagnitude(img, x, y) > threshold {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sobelMagnitude returns the Sobel gradient magnitude of the image luminance
+// at (x, y), clamping neighbors to the image bounds
+func sobelMagnitude(img image.Image, x, y int) float64 {
+	var l [3][3]float64
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			l[dy+1][dx+1] = clampedLuminance(img, x+dx, y+dy)
+		}
+	}
+
+	gx := (l[0][2] + 2*l[1][2] + l[2][2]) - (l[0][0] + 2*l[1][0] + l[2][0])
+	gy := (l[2][0] + 2*l[2][1] + l[2][2]) - (l[0][0] + 2*l[0][1] + l[0][2])
+	return math.Sqrt(gx*gx + gy*gy)
+}
+
+// clampedLuminance returns the luminance of the pixel nearest to (x, y)
+// within the image bounds
+func clampedLuminance(img image.Image, x, y int) float64 {
+	bounds := img.Bounds()
+	x = max(bounds.Min.X, min(x, bounds.Max.X-1))
+	y = max(bounds.Min.Y, min(y, bounds.Max.Y-1))
+
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 65535
+}
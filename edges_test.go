@@ -0,0 +1,99 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDrawEdges(t *testing.T) {
+	// Create test image with a sharp boundary at x=20
+	width, height := 40, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 20 {
+				img.Set(x, y, color.RGBA{A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+
+	edgeColor := color.RGBA{R: 255, A: 255}
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.DrawEdges = true
+	opts.EdgeColor = edgeColor
+
+	result := CreateMosaic(img, opts)
+
+	// Pixels along the boundary are edge-colored
+	for y := 0; y < height; y++ {
+		if got := result.At(20, y); got != edgeColor {
+			t.Fatalf("boundary pixel (20,%d) = %v, want %v", y, got, edgeColor)
+		}
+	}
+
+	// Flat areas have no edges
+	if got := result.At(5, 10); got == edgeColor {
+		t.Errorf("flat pixel = %v, want mosaic color", got)
+	}
+}
+
+func TestEdgeAware(t *testing.T) {
+	// Create test image with a hard edge at x=15, inside the second block
+	// column, and a faint texture elsewhere
+	width, height := 40, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x + y) % 3 * 4)
+			if x >= 15 {
+				v += 200
+			}
+			img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	distinct := func(result image.Image, rect image.Rectangle) int {
+		colors := make(map[color.Color]bool)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				colors[result.At(x, y)] = true
+			}
+		}
+		return len(colors)
+	}
+
+	tests := []struct {
+		name      string
+		edgeAware bool
+	}{
+		{"off", false},
+		{"on", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.K = 2
+			opts.EdgeAware = tt.edgeAware
+
+			result := CreateMosaic(img, opts)
+
+			// The edge-straddling block keeps more than one color only when edge aware
+			edgeBlock := image.Rect(10, 0, 20, 10)
+			if got := distinct(result, edgeBlock); (got > 1) != tt.edgeAware {
+				t.Errorf("edge block has %d colors, want crisp = %v", got, tt.edgeAware)
+			}
+
+			// Flat blocks are mosaicked either way
+			for _, flat := range []image.Rectangle{image.Rect(0, 0, 10, 10), image.Rect(30, 10, 40, 20)} {
+				if got := distinct(result, flat); got != 1 {
+					t.Errorf("flat block %v has %d colors, want 1", flat, got)
+				}
+			}
+		})
+	}
+}
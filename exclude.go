@@ -0,0 +1,59 @@
+package mosaic
+
+import (
+	"image"
+	"image/draw"
+)
+
+// withoutExcluded returns the pixels that are not within ExcludeTolerance
+// of an ExcludeColors color, or pixels itself when nothing is excluded.
+// Pixels are compared after the configured color conversions.
+func (opts *MosaicOptions) withoutExcluded(pixels []Pixel) []Pixel {
+	if len(opts.ExcludeColors) == 0 {
+		return pixels
+	}
+	excluded := make([]Pixel, len(opts.ExcludeColors))
+	for i, c := range opts.ExcludeColors {
+		excluded[i] = opts.convertPixel(rgbaToPixel(c))
+	}
+
+	var kept []Pixel
+	for _, p := range pixels {
+		if !matchesAny(p, excluded, opts.ExcludeTolerance) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// restoreExcluded puts back the original pixels of the regions that are
+// within ExcludeTolerance of an ExcludeColors color
+func restoreExcluded(mosaic draw.Image, img image.Image, regions []*Region, opts *MosaicOptions) {
+	excluded := make([]Pixel, len(opts.ExcludeColors))
+	for i, c := range opts.ExcludeColors {
+		excluded[i] = rgbaToPixel(c)
+	}
+
+	bounds := img.Bounds()
+	original := pixelReader(img)
+	for _, region := range regions {
+		rect := region.rect().Intersect(bounds)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if region.contains(x, y) && matchesAny(original(x, y), excluded, opts.ExcludeTolerance) {
+					mosaic.Set(x, y, img.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+// matchesAny reports whether p lies within tolerance of one of colors
+func matchesAny(p Pixel, colors []Pixel, tolerance float64) bool {
+	for _, c := range colors {
+		if distance(p, c) <= tolerance {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestExcludeColors(t *testing.T) {
+	// A white page with a line of black text and three small colored marks
+	white, black := color.RGBA{R: 255, G: 255, B: 255, A: 255}, color.RGBA{A: 255}
+	marks := []color.RGBA{{R: 220, G: 30, B: 30, A: 255}, {G: 160, B: 60, A: 255}, {R: 40, G: 60, B: 230, A: 255}}
+	img := image.NewRGBA(image.Rect(0, 0, 60, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 60; x++ {
+			c := white
+			switch {
+			case y >= 4 && y < 8 && x%3 != 0:
+				c = black
+			case y >= 20 && y < 24 && x%20 < 4:
+				c = marks[x/20]
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 3
+	opts.InitMethod = InitPlusPlus
+	opts.Seed = 1
+
+	// White and black use up centroids that the marks need
+	if got := ExtractPalette(img, opts); containsAll(got, marks) {
+		t.Fatalf("ExtractPalette() = %v without exclusion, want some marks merged", got)
+	}
+
+	opts.ExcludeColors = []color.RGBA{white, black}
+	opts.ExcludeTolerance = 0.1
+	if got := ExtractPalette(img, opts); !containsAll(got, marks) {
+		t.Errorf("ExtractPalette() = %v, want every mark color %v", got, marks)
+	}
+
+	// KeepExcluded passes the page through unchanged around a mark
+	opts.BlockSize = 10
+	opts.KeepExcluded = true
+	result := CreateMosaicRGBA(img, opts)
+	if got := result.RGBAAt(5, 21); got != white {
+		t.Errorf("page pixel next to a mark = %v, want %v", got, white)
+	}
+	if got := result.RGBAAt(1, 21); got == img.RGBAAt(1, 21) {
+		t.Errorf("mark pixel = %v, want it mosaicked", got)
+	}
+}
+
+// containsAll reports whether palette contains every one of colors
+func containsAll(palette, colors []color.RGBA) bool {
+	for _, c := range colors {
+		found := false
+		for _, p := range palette {
+			found = found || p == c
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
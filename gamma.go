@@ -0,0 +1,43 @@
+package mosaic
+
+import "math"
+
+// srgbToLinear converts an sRGB-encoded channel value to linear light
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts a linear-light channel value to sRGB encoding
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// linearizePixel converts an sRGB pixel to linear light
+func linearizePixel(p Pixel) Pixel {
+	return Pixel{R: srgbToLinear(p.R), G: srgbToLinear(p.G), B: srgbToLinear(p.B)}
+}
+
+// encodePixel converts a linear-light pixel to sRGB
+func encodePixel(p Pixel) Pixel {
+	return Pixel{R: linearToSRGB(p.R), G: linearToSRGB(p.G), B: linearToSRGB(p.B)}
+}
+
+// outputPixel converts a centroid to the color written to the output,
+// undoing LinearizeGamma and applying SaturationScale and BrightnessScale.
+// The colors of a fixed Palette are already output colors, e.g. from
+// ExtractPalette or ReadPalette, so they are not adjusted a second time.
+func (opts *MosaicOptions) outputPixel(p Pixel) Pixel {
+	if opts.LinearizeGamma {
+		p = encodePixel(p)
+	}
+	if len(opts.Palette) > 0 && !opts.NoQuantize {
+		return p
+	}
+	return opts.adjustPixel(p)
+}
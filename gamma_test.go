@@ -0,0 +1,47 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestLinearizeGamma(t *testing.T) {
+	// A single block that is a 50/50 checkerboard of red and green
+	size := 10
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if (x+y)%2 == 0 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{G: 255, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 1
+	opts.BlockSize = size
+
+	naive := CreateMosaic(img, opts).At(0, 0).(color.RGBA)
+	opts.LinearizeGamma = true
+	linear := CreateMosaic(img, opts).At(0, 0).(color.RGBA)
+
+	if linear.R <= naive.R || linear.G <= naive.G {
+		t.Errorf("linear average %v is not brighter than naive average %v", linear, naive)
+	}
+	if linear.R != linear.G || linear.B != 0 {
+		t.Errorf("linear average %v, want an even yellow", linear)
+	}
+}
+
+func TestGammaRoundTrip(t *testing.T) {
+	for i := 0; i <= 255; i++ {
+		v := float64(i) / 255
+		if got := linearToSRGB(srgbToLinear(v)); math.Abs(got-v) > 1e-9 {
+			t.Fatalf("round trip of %v = %v", v, got)
+		}
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/kohge4/mosaic-image
 
-go 1.23
+go 1.23.0
+
+require golang.org/x/image v0.25.0
@@ -0,0 +1,125 @@
+package mosaic
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// defaultScreenAngles are the classic C, M, Y and K halftone screen angles
+var defaultScreenAngles = [4]float64{15, 75, 0, 45}
+
+// halftoneScreen is the rotated dot grid of one ink
+type halftoneScreen struct {
+	ink      int // 0-3 for C, M, Y, K
+	cos, sin float64
+	size     float64
+	coverage map[image.Point]float64 // ink coverage by cell, sampled lazily
+}
+
+// drawHalftone renders a region as composited CMYK halftone screens
+func drawHalftone(mosaic draw.Image, img image.Image, region *Region, opts *MosaicOptions) {
+	angles := opts.ScreenAngles
+	if angles == [4]float64{} {
+		angles = defaultScreenAngles
+	}
+
+	size := float64(max(1, opts.BlockSize))
+	screens := make([]*halftoneScreen, 4)
+	for ink, angle := range angles {
+		rad := angle * math.Pi / 180
+		screens[ink] = &halftoneScreen{
+			ink:      ink,
+			cos:      math.Cos(rad),
+			sin:      math.Sin(rad),
+			size:     size,
+			coverage: make(map[image.Point]float64),
+		}
+	}
+
+	for y := region.Y; y < region.Y+region.Height; y++ {
+		for x := region.X; x < region.X+region.Width; x++ {
+			// Pixel center relative to the region origin
+			px := float64(x-region.X) + 0.5
+			py := float64(y-region.Y) + 0.5
+
+			var inks [4]float64
+			for _, s := range screens {
+				if s.inDot(img, region, px, py) {
+					inks[s.ink] = 1
+				}
+			}
+			mosaic.Set(x, y, outputColor(mosaic, cmykToPixel(inks)))
+		}
+	}
+}
+
+// inDot reports whether the point (px, py), relative to the region origin,
+// is covered by a dot of the screen. Dots larger than their cell spill into
+// neighboring cells, so the surrounding cells are checked too.
+func (s *halftoneScreen) inDot(img image.Image, region *Region, px, py float64) bool {
+	// Rotate into screen space
+	u := px*s.cos + py*s.sin
+	v := -px*s.sin + py*s.cos
+	cu := int(math.Floor(u / s.size))
+	cv := int(math.Floor(v / s.size))
+
+	for dv := -1; dv <= 1; dv++ {
+		for du := -1; du <= 1; du++ {
+			cell := image.Pt(cu+du, cv+dv)
+			centerU := (float64(cell.X) + 0.5) * s.size
+			centerV := (float64(cell.Y) + 0.5) * s.size
+
+			// A dot's area is the ink coverage of its cell
+			r := s.size * math.Sqrt(s.cellCoverage(img, region, cell, centerU, centerV)/math.Pi)
+			eu, ev := u-centerU, v-centerV
+			if r > 0 && eu*eu+ev*ev <= r*r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cellCoverage returns the screen's ink coverage at the center of a cell,
+// sampling the image pixel nearest to it within the region
+func (s *halftoneScreen) cellCoverage(img image.Image, region *Region, cell image.Point, centerU, centerV float64) float64 {
+	if c, ok := s.coverage[cell]; ok {
+		return c
+	}
+
+	// Rotate the cell center back into image space
+	x := region.X + int(math.Floor(centerU*s.cos-centerV*s.sin))
+	y := region.Y + int(math.Floor(centerU*s.sin+centerV*s.cos))
+	x = max(region.X, min(x, region.X+region.Width-1))
+	y = max(region.Y, min(y, region.Y+region.Height-1))
+
+	c := pixelToCMYK(PixelFromColor(img.At(x, y)))[s.ink]
+	s.coverage[cell] = c
+	return c
+}
+
+// pixelToCMYK separates a pixel into cyan, magenta, yellow and black ink
+// coverage in [0, 1]
+func pixelToCMYK(p Pixel) [4]float64 {
+	k := 1 - max(p.R, p.G, p.B)
+	if k >= 1 {
+		return [4]float64{0, 0, 0, 1}
+	}
+	return [4]float64{
+		(1 - p.R - k) / (1 - k),
+		(1 - p.G - k) / (1 - k),
+		(1 - p.B - k) / (1 - k),
+		k,
+	}
+}
+
+// cmykToPixel composites ink coverages on white paper
+func cmykToPixel(inks [4]float64) Pixel {
+	k := 1 - inks[3]
+	return Pixel{
+		R: (1 - inks[0]) * k,
+		G: (1 - inks[1]) * k,
+		B: (1 - inks[2]) * k,
+	}
+}
@@ -0,0 +1,80 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCMYKHalftone(t *testing.T) {
+	// Create test image with pure cyan on the left and mid gray on the right
+	width, height := 60, 30
+	cyan := color.RGBA{G: 255, B: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 30 {
+				img.Set(x, y, cyan)
+			} else {
+				img.Set(x, y, color.RGBA{R: 128, G: 128, B: 128, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.CMYKHalftone = true
+	opts.Region = &Region{X: 0, Y: 0, Width: 30, Height: height}
+
+	result := CreateMosaic(img, opts)
+
+	// The cyan region is printed with cyan dots on white paper only
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	counts := make(map[color.Color]int)
+	for y := 0; y < height; y++ {
+		for x := 0; x < 30; x++ {
+			counts[result.At(x, y)]++
+		}
+	}
+	for c := range counts {
+		if c != cyan && c != white {
+			t.Errorf("cyan region contains %v, want only %v dots on %v", c, cyan, white)
+		}
+	}
+	if counts[cyan] == 0 || counts[white] == 0 {
+		t.Errorf("cyan region has %d cyan and %d white pixels, want a dot pattern", counts[cyan], counts[white])
+	}
+
+	// Outside the region the image is unchanged
+	if got, want := result.At(45, 15), img.At(45, 15); got != want {
+		t.Errorf("pixel outside region = %v, want %v", got, want)
+	}
+}
+
+func TestCMYKHalftoneGrayDots(t *testing.T) {
+	// A mid gray prints as a pattern of differently inked dots
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 128, G: 128, B: 128, A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.CMYKHalftone = true
+
+	result := CreateMosaic(img, opts)
+
+	colors := make(map[color.Color]bool)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			colors[result.At(x, y)] = true
+		}
+	}
+	if !colors[color.RGBA{R: 255, G: 255, B: 255, A: 255}] {
+		t.Error("gray halftone has no white paper showing")
+	}
+	if len(colors) < 2 {
+		t.Errorf("gray halftone uses %d colors, want a dot pattern", len(colors))
+	}
+}
@@ -0,0 +1,74 @@
+package mosaic
+
+import (
+	"image"
+	"image/draw"
+)
+
+// heatmapOpacity is how strongly the heat colors cover the original image
+const heatmapOpacity = 0.5
+
+// PreviewHeatmap returns the image overlaid with a translucent heatmap of
+// where mosaicking will change it most, without quantizing any colors.
+// Each block is tinted from blue (flat, little visible change) to red (the
+// highest pixel variance in the image).
+func PreviewHeatmap(img image.Image, opts *MosaicOptions) image.Image {
+	opts = opts.Normalize()
+	opts = opts.withInvertedRegions()
+
+	bounds := img.Bounds()
+	preview := image.NewRGBA(bounds)
+	draw.Draw(preview, bounds, img, bounds.Min, draw.Src)
+
+	type heatBlock struct {
+		region   *Region
+		rect     image.Rectangle
+		variance float64
+	}
+
+	var blocks []heatBlock
+	maxVariance := 0.0
+	for _, region := range opts.regions(bounds) {
+		for _, rect := range regionBlocks(img, region, opts) {
+			v := pixelVariance(opts.readPixels(img, blockRegion(region, rect)))
+			blocks = append(blocks, heatBlock{region: region, rect: rect, variance: v})
+			maxVariance = max(maxVariance, v)
+		}
+	}
+
+	// Record the heat of every covered pixel, later blocks winning where
+	// blocks overlap, so that each pixel is tinted once
+	heat := make([]float64, bounds.Dx()*bounds.Dy())
+	for i := range heat {
+		heat[i] = -1
+	}
+	for _, block := range blocks {
+		t := 0.0
+		if maxVariance > 0 {
+			t = block.variance / maxVariance
+		}
+		r := block.rect.Intersect(block.region.rect())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				heat[(y-bounds.Min.Y)*bounds.Dx()+(x-bounds.Min.X)] = t
+			}
+		}
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			t := heat[(y-bounds.Min.Y)*bounds.Dx()+(x-bounds.Min.X)]
+			if t < 0 {
+				continue
+			}
+			orig := rgbaToPixel(preview.RGBAAt(x, y))
+			preview.SetRGBA(x, y, (Pixel{
+				R: orig.R + (t-orig.R)*heatmapOpacity,
+				G: orig.G - orig.G*heatmapOpacity,
+				B: orig.B + (1-t-orig.B)*heatmapOpacity,
+			}).ToRGBA())
+		}
+	}
+
+	return preview
+}
@@ -0,0 +1,47 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPreviewHeatmap(t *testing.T) {
+	// Create test image with flat gray on the left and a noisy checkerboard
+	// on the right
+	width, height := 40, 20
+	gray := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case x < 20:
+				img.Set(x, y, gray)
+			case (x+y)%2 == 0:
+				img.Set(x, y, color.RGBA{A: 255})
+			default:
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+
+	preview := PreviewHeatmap(img, DefaultOptions())
+
+	flat := preview.At(5, 5).(color.RGBA)
+	busy := preview.At(35, 5).(color.RGBA)
+
+	// Busy blocks are warmer (redder, less blue) than flat ones
+	if int(busy.R)-int(busy.B) <= int(flat.R)-int(flat.B) {
+		t.Errorf("busy pixel %v is not warmer than flat pixel %v", busy, flat)
+	}
+
+	// The original gray still shows through the overlay
+	if flat.G == 0 {
+		t.Errorf("flat pixel %v hides the original color", flat)
+	}
+
+	// The input is left untouched
+	if got := img.At(5, 5); got != gray {
+		t.Errorf("input pixel = %v, want %v", got, gray)
+	}
+}
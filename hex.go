@@ -0,0 +1,148 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// hexGrid is a layout of pointy-top hexagonal cells over a region. Cell
+// centers are size apart within a row, rows are size*sqrt(3)/2 apart, and
+// odd rows are shifted right by half a cell.
+type hexGrid struct {
+	size    int
+	rowStep float64
+	origin  image.Point
+	rows    [][]int       // indices into centers for each row
+	centers []image.Point // cell centers in scan order
+}
+
+// newHexGrid lays out hexagonal cells of the given width over a region
+func newHexGrid(region *Region, size int) *hexGrid {
+	size = max(1, size)
+	g := &hexGrid{
+		size:    size,
+		rowStep: float64(size) * math.Sqrt(3) / 2,
+		origin:  image.Pt(region.X, region.Y),
+	}
+
+	for row := 0; ; row++ {
+		y := region.Y + int(math.Round(float64(row)*g.rowStep))
+		if y >= region.Y+region.Height {
+			break
+		}
+		var indices []int
+		for x := region.X + g.rowOffset(row); x < region.X+region.Width+g.size/2; x += size {
+			indices = append(indices, len(g.centers))
+			g.centers = append(g.centers, image.Pt(x, y))
+		}
+		g.rows = append(g.rows, indices)
+	}
+
+	return g
+}
+
+// rowOffset returns how far the first center of a row is from the region's
+// left edge
+func (g *hexGrid) rowOffset(row int) int {
+	return (row % 2) * g.size / 2
+}
+
+// cellBounds returns the bounding box of cell i
+func (g *hexGrid) cellBounds(i int) image.Rectangle {
+	c := g.centers[i]
+	halfHeight := int(math.Round(float64(g.size) / math.Sqrt(3)))
+	return image.Rect(c.X-g.size/2, c.Y-halfHeight, c.X-g.size/2+g.size, c.Y+halfHeight)
+}
+
+// nearest returns the index of the cell center closest to (x, y). Every
+// point belongs to a cell, including those past the outermost centers.
+func (g *hexGrid) nearest(x, y int) int {
+	best, bestDist := -1, math.MaxInt
+	row := int(math.Round(float64(y-g.origin.Y) / g.rowStep))
+	for r := row - 1; r <= row+1; r++ {
+		if r < 0 || r >= len(g.rows) {
+			continue
+		}
+		indices := g.rows[r]
+		col := (x - g.origin.X - g.rowOffset(r) + g.size/2) / g.size
+		for c := col - 1; c <= col+1; c++ {
+			if c < 0 || c >= len(indices) {
+				continue
+			}
+			center := g.centers[indices[c]]
+			dx, dy := x-center.X, y-center.Y
+			if d := dx*dx + dy*dy; d < bestDist {
+				best, bestDist = indices[c], d
+			}
+		}
+	}
+	return best
+}
+
+// paintHexRegion paints a region as a honeycomb of hexagonal cells, each
+// filled with the centroid nearest to the average of its pixels.
+// Centroids that color a cell are marked in used.
+func paintHexRegion(mosaic draw.Image, img image.Image, region *Region, centroids []Pixel, used []bool, dist distanceFunc, opts *MosaicOptions, prog *progress) {
+	grid := newHexGrid(region, opts.BlockSize)
+	if len(grid.centers) == 0 {
+		return
+	}
+
+	// Assign every pixel of the region to its nearest cell
+	cells := make([]int, region.Width*region.Height)
+	sums := make([]Pixel, len(grid.centers))
+	counts := make([]int, len(grid.centers))
+	pixelAt := pixelReader(img)
+	transparent := opts.transparentMask(img)
+	for y := region.Y; y < region.Y+region.Height; y++ {
+		for x := region.X; x < region.X+region.Width; x++ {
+			cell := grid.nearest(x, y)
+			cells[(y-region.Y)*region.Width+(x-region.X)] = cell
+			if inAnyRect(x, y, opts.PreserveBoxes) || !region.contains(x, y) || (transparent != nil && transparent(x, y)) {
+				continue
+			}
+			p := opts.convertPixel(pixelAt(x, y))
+			sums[cell].R += p.R
+			sums[cell].G += p.G
+			sums[cell].B += p.B
+			counts[cell]++
+		}
+	}
+
+	cache := newCentroidCache(opts.CentroidCacheBits)
+	nearest := opts.nearestCentroidFunc(centroids, dist)
+	colors := make([]color.Color, len(grid.centers))
+	for i := range grid.centers {
+		var c Pixel
+		if len(opts.PositionRamp) > 0 {
+			c = rampColor(opts.PositionRamp, region, grid.cellBounds(i))
+		} else if counts[i] > 0 {
+			n := float64(counts[i])
+			avg := Pixel{R: sums[i].R / n, G: sums[i].G / n, B: sums[i].B / n}
+			if opts.NoQuantize {
+				c = opts.outputPixel(avg)
+			} else {
+				idx := cache.nearestIndex(avg, nearest)
+				used[idx] = true
+				c = opts.outputPixel(centroids[idx])
+			}
+		}
+		// Fully transparent cells are left untouched
+		if len(opts.PositionRamp) == 0 && counts[i] == 0 && opts.IgnoreTransparent {
+			prog.step()
+			continue
+		}
+		colors[i] = outputColor(mosaic, c)
+		prog.step()
+	}
+
+	for y := region.Y; y < region.Y+region.Height; y++ {
+		for x := region.X; x < region.X+region.Width; x++ {
+			if cell := cells[(y-region.Y)*region.Width+(x-region.X)]; colors[cell] != nil {
+				mosaic.Set(x, y, colors[cell])
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestHexGridRowsOffset(t *testing.T) {
+	size := 10
+	grid := newHexGrid(&Region{X: 5, Y: 5, Width: 60, Height: 40}, size)
+
+	if len(grid.rows) < 2 {
+		t.Fatalf("got %d rows, want at least 2", len(grid.rows))
+	}
+
+	first, second := grid.centers[grid.rows[0][0]], grid.centers[grid.rows[1][0]]
+	if got := second.X - first.X; got != size/2 {
+		t.Errorf("second row offset = %d, want %d", got, size/2)
+	}
+	if second.Y <= first.Y {
+		t.Errorf("second row y = %d, want below first row y = %d", second.Y, first.Y)
+	}
+}
+
+func TestCreateMosaicHexLayout(t *testing.T) {
+	// Create test image with black on the left and white on the right
+	width, height := 40, 30
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 20 {
+				img.Set(x, y, color.RGBA{A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.BlockLayout = LayoutHex
+
+	result := CreateMosaic(img, opts)
+
+	// Every pixel, including those at the edges, is painted by a cell
+	black := color.RGBA{A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got := result.At(x, y); got != black && got != white {
+				t.Fatalf("pixel (%d,%d) = %v, want %v or %v", x, y, got, black, white)
+			}
+		}
+	}
+
+	// Cells away from the boundary keep their side's color
+	if got := result.At(2, 15); got != black {
+		t.Errorf("left pixel = %v, want %v", got, black)
+	}
+	if got := result.At(37, 15); got != white {
+		t.Errorf("right pixel = %v, want %v", got, white)
+	}
+}
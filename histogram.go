@@ -0,0 +1,138 @@
+package mosaic
+
+import (
+	"image"
+	"math"
+)
+
+// ColorHistogram counts the pixels of a region (nil for the entire image) in
+// a bins×bins×bins grid of quantized colors. The result is flattened so that
+// the count for the bin (r, g, b) is at index (r*bins+g)*bins+b.
+func ColorHistogram(img image.Image, region *Region, bins int) []int {
+	if bins < 1 {
+		bins = 1
+	}
+
+	histogram := make([]int, bins*bins*bins)
+	for _, p := range imageToPixels(img, resolveRegion(img.Bounds(), region)) {
+		r := histogramBin(p.R, bins)
+		g := histogramBin(p.G, bins)
+		b := histogramBin(p.B, bins)
+		histogram[(r*bins+g)*bins+b]++
+	}
+
+	return histogram
+}
+
+// histogramBin returns the bin of a channel value in [0, 1]
+func histogramBin(v float64, bins int) int {
+	return min(int(v*float64(bins)), bins-1)
+}
+
+// histogramBits is the number of bits per channel of the histogram that
+// UseHistogram clusters
+const histogramBits = 6
+
+// histogramBins groups pixels into a grid of 2^bits levels per channel and
+// returns the mean color and pixel count of each non-empty bin, in the order
+// the bins are first reached
+func histogramBins(pixels []Pixel, bits int) ([]Pixel, []int) {
+	levels := 1 << bits
+	index := make(map[int]int)
+	var sums []Pixel
+	var counts []int
+	for _, p := range pixels {
+		key := (histogramBin(clamp01(p.R), levels)*levels+histogramBin(clamp01(p.G), levels))*levels + histogramBin(clamp01(p.B), levels)
+		i, ok := index[key]
+		if !ok {
+			i = len(sums)
+			index[key] = i
+			sums = append(sums, Pixel{})
+			counts = append(counts, 0)
+		}
+		sums[i].R += p.R
+		sums[i].G += p.G
+		sums[i].B += p.B
+		counts[i]++
+	}
+
+	for i, n := range counts {
+		sums[i] = Pixel{R: sums[i].R / float64(n), G: sums[i].G / float64(n), B: sums[i].B / float64(n)}
+	}
+	return sums, counts
+}
+
+// refineWeightedCentroids runs k-means iterations like refineCentroids over
+// histogram bins, weighting each bin by its count raised to WeightPower.
+// ClusterSizes counts the pixels of the bins in each cluster.
+func refineWeightedCentroids(bins []Pixel, counts []int, centroids []Pixel, opts *MosaicOptions) ([]Pixel, *MosaicStats) {
+	power := opts.WeightPower
+	if power == 0 {
+		power = 1
+	}
+	weights := make([]float64, len(counts))
+	for i, n := range counts {
+		weights[i] = math.Pow(float64(n), power)
+	}
+
+	k := len(centroids)
+	dist := opts.distanceFunc()
+	dists := make([]float64, len(bins))
+	stats := &MosaicStats{}
+	initialDiff := 0.0 // largest centroid move of the first iteration
+
+	for iteration := 0; iteration < opts.Iterations; iteration++ {
+		// Assign bins to clusters, accumulating weighted sums
+		sums := make([]Pixel, k)
+		totals := make([]float64, k)
+		sizes := make([]int, k)
+		nearest := opts.nearestCentroidFunc(centroids, dist)
+		for j, p := range bins {
+			i := nearest(p)
+			w := weights[j]
+			sums[i].R += p.R * w
+			sums[i].G += p.G * w
+			sums[i].B += p.B * w
+			totals[i] += w
+			sizes[i] += counts[j]
+			dists[j] = dist(p, centroids[i])
+		}
+
+		// Update centroids
+		newCentroids := make([]Pixel, k)
+		maxDiff := 0.0
+		for i := range centroids {
+			if totals[i] > 0 {
+				newCentroids[i] = Pixel{R: sums[i].R / totals[i], G: sums[i].G / totals[i], B: sums[i].B / totals[i]}
+			} else {
+				// Reseed empty clusters with the bin farthest from its centroid
+				newCentroids[i] = centroids[i]
+				if far := farthestPixelIndex(dists); far >= 0 {
+					newCentroids[i] = bins[far]
+					dists[far] = 0
+				}
+			}
+			maxDiff = max(maxDiff, distance(centroids[i], newCentroids[i]))
+		}
+
+		centroids = newCentroids
+
+		stats.IterationsRun = iteration + 1
+		if opts.IterationFunc != nil {
+			opts.IterationFunc(iteration+1, centroids)
+		}
+		stats.FinalMaxDiff = maxDiff
+		if iteration == 0 {
+			initialDiff = maxDiff
+		}
+		stats.ClusterSizes = sizes
+
+		// Check for convergence
+		if opts.converged(stats.IterationsRun, maxDiff, initialDiff) {
+			stats.Converged = true
+			break
+		}
+	}
+
+	return centroids, stats
+}
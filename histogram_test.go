@@ -0,0 +1,117 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestColorHistogram(t *testing.T) {
+	// Create test image with 30 red and 70 blue pixels
+	width, height := 10, 10
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 3 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	bins := 4
+	histogram := ColorHistogram(img, nil, bins)
+
+	if len(histogram) != bins*bins*bins {
+		t.Fatalf("ColorHistogram() returned %d bins, want %d", len(histogram), bins*bins*bins)
+	}
+
+	redBin := (3*bins + 0) * bins
+	blueBin := 3
+	expected := map[int]int{redBin: 30, blueBin: 70}
+
+	for i, n := range histogram {
+		if n != expected[i] {
+			t.Errorf("histogram[%d] = %d, want %d", i, n, expected[i])
+		}
+	}
+}
+
+func TestUseHistogram(t *testing.T) {
+	// Create three noisy color clusters of different sizes
+	rng := rand.New(rand.NewSource(1))
+	centers := []color.RGBA{{R: 200, G: 40, B: 40}, {R: 40, G: 180, B: 60}, {R: 50, G: 60, B: 210}}
+	img := image.NewRGBA(image.Rect(0, 0, 60, 60))
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 60; x++ {
+			c := centers[min(x/15, 2)]
+			jitter := func(v uint8) uint8 { return uint8(int(v) + rng.Intn(31) - 15) }
+			img.Set(x, y, color.RGBA{R: jitter(c.R), G: jitter(c.G), B: jitter(c.B), A: 255})
+		}
+	}
+
+	palette := func(useHistogram bool) []color.RGBA {
+		opts := DefaultOptions()
+		opts.K = 3
+		opts.InitMethod = InitPlusPlus
+		opts.Seed = 1
+		opts.UseHistogram = useHistogram
+		_, stats := CreateMosaicWithStats(img, opts)
+		sorted := append([]color.RGBA(nil), stats.Palette...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].R+sorted[i].G < sorted[j].R+sorted[j].G })
+		return sorted
+	}
+
+	full, weighted := palette(false), palette(true)
+	if len(full) != 3 || len(weighted) != 3 {
+		t.Fatalf("palettes = %v and %v, want 3 colors each", full, weighted)
+	}
+	for i := range full {
+		d := distance(rgbaToPixel(full[i]), rgbaToPixel(weighted[i]))
+		if d > 0.01 {
+			t.Errorf("histogram color %v is %.3f from full clustering color %v", weighted[i], d, full[i])
+		}
+	}
+}
+
+func TestWeightPower(t *testing.T) {
+	// A large black area, a smaller dark gray area and a light gray area
+	pixels := make([]Pixel, 0, 1100)
+	for i := 0; i < 900; i++ {
+		pixels = append(pixels, Pixel{})
+	}
+	for i := 0; i < 100; i++ {
+		pixels = append(pixels, Pixel{R: 0.1, G: 0.1, B: 0.1}, Pixel{R: 0.9, G: 0.9, B: 0.9})
+	}
+
+	tests := []struct {
+		name     string
+		power    float64
+		min, max float64 // bounds of the dark centroid
+	}{
+		{"pixel count", 0, 0.005, 0.015},
+		{"flattened", 0.01, 0.045, 0.055},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.K = 2
+			opts.InitMethod = InitFixedSampling
+			opts.UseHistogram = true
+			opts.WeightPower = tt.power
+
+			centroids, stats := kmeans(pixels, opts)
+			dark := min(centroids[0].R, centroids[1].R)
+			if dark < tt.min || dark > tt.max {
+				t.Errorf("dark centroid = %.4f, want in [%v, %v]", dark, tt.min, tt.max)
+			}
+			if stats.ClusterSizes[0]+stats.ClusterSizes[1] != len(pixels) {
+				t.Errorf("cluster sizes %v do not add up to %d pixels", stats.ClusterSizes, len(pixels))
+			}
+		})
+	}
+}
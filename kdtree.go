@@ -0,0 +1,152 @@
+package mosaic
+
+import "sort"
+
+// kdTreeThreshold is the number of centroids from which nearest-centroid
+// lookups go through a kd-tree instead of scanning every centroid
+const kdTreeThreshold = 32
+
+// kdLeafSize is the number of centroids from which a kd-tree range is split
+// further rather than scanned
+const kdLeafSize = 8
+
+// kdTree finds the nearest centroid by weighted squared distance in
+// O(log k) on average. It returns exactly what findNearestCentroidIndex
+// returns, ties included.
+type kdTree struct {
+	centroids []Pixel
+	weights   [3]float64
+	dist      distanceFunc
+	order     []int // centroid indices laid out as an implicit balanced tree
+	axes      []int // channel each range is split on, at the index of its median
+}
+
+// newKDTree builds a kd-tree over centroids for dist, a squared distance
+// with the given channel weights (zero weights for unweighted distance)
+func newKDTree(centroids []Pixel, weights [3]float64, dist distanceFunc) *kdTree {
+	if weights == [3]float64{} {
+		weights = [3]float64{1, 1, 1}
+	}
+	t := &kdTree{
+		centroids: centroids,
+		weights:   weights,
+		dist:      dist,
+		order:     make([]int, len(centroids)),
+		axes:      make([]int, len(centroids)),
+	}
+	for i := range t.order {
+		t.order[i] = i
+	}
+	t.build(0, len(t.order))
+	return t
+}
+
+// build sorts order[lo:hi] by its widest channel so that its median splits
+// the range, then builds both halves. Small ranges are left as leaves.
+func (t *kdTree) build(lo, hi int) {
+	if hi-lo <= kdLeafSize {
+		return
+	}
+
+	// Split on the channel with the largest spread
+	axis, spread := 0, -1.0
+	for a := 0; a < 3; a++ {
+		minV, maxV := channel(t.centroids[t.order[lo]], a), channel(t.centroids[t.order[lo]], a)
+		for _, i := range t.order[lo+1 : hi] {
+			v := channel(t.centroids[i], a)
+			minV, maxV = min(minV, v), max(maxV, v)
+		}
+		if maxV-minV > spread {
+			axis, spread = a, maxV-minV
+		}
+	}
+
+	order := t.order[lo:hi]
+	sort.Slice(order, func(a, b int) bool {
+		return channel(t.centroids[order[a]], axis) < channel(t.centroids[order[b]], axis)
+	})
+	mid := (lo + hi) / 2
+	t.axes[mid] = axis
+	t.build(lo, mid)
+	t.build(mid+1, hi)
+}
+
+// nearest returns the index of the centroid nearest to p and its distance
+func (t *kdTree) nearest(p Pixel) (int, float64) {
+	best, bestDist := -1, 0.0
+	t.search(0, len(t.order), p, &best, &bestDist)
+	return best, bestDist
+}
+
+// search looks for a centroid nearer than the best so far in order[lo:hi],
+// skipping the far half when the splitting plane is farther than the best
+func (t *kdTree) search(lo, hi int, p Pixel, best *int, bestDist *float64) {
+	if hi-lo <= kdLeafSize {
+		for _, i := range t.order[lo:hi] {
+			t.consider(i, p, best, bestDist)
+		}
+		return
+	}
+
+	mid := (lo + hi) / 2
+	i := t.order[mid]
+	c := t.centroids[i]
+	t.consider(i, p, best, bestDist)
+
+	axis := t.axes[mid]
+	diff := channel(p, axis) - channel(c, axis)
+	nearLo, nearHi, farLo, farHi := lo, mid, mid+1, hi
+	if diff >= 0 {
+		nearLo, nearHi, farLo, farHi = mid+1, hi, lo, mid
+	}
+	t.search(nearLo, nearHi, p, best, bestDist)
+	// Ties on the plane are searched too, as they may win by color
+	if t.weights[axis]*diff*diff <= *bestDist {
+		t.search(farLo, farHi, p, best, bestDist)
+	}
+}
+
+// consider makes centroid i the best if it is nearer to p, or as near and
+// preferred
+func (t *kdTree) consider(i int, p Pixel, best *int, bestDist *float64) {
+	if d := t.dist(p, t.centroids[i]); *best < 0 || d < *bestDist || (d == *bestDist && t.prefer(i, *best)) {
+		*best, *bestDist = i, d
+	}
+}
+
+// prefer reports whether centroid i wins a distance tie with centroid j:
+// the smaller color wins, and the earlier index among equal colors
+func (t *kdTree) prefer(i, j int) bool {
+	a, b := t.centroids[i], t.centroids[j]
+	if a == b {
+		return i < j
+	}
+	return pixelLess(a, b)
+}
+
+// channel returns the R, G or B value of p for axis 0, 1 or 2
+func channel(p Pixel, axis int) float64 {
+	switch axis {
+	case 0:
+		return p.R
+	case 1:
+		return p.G
+	}
+	return p.B
+}
+
+// nearestCentroidFunc returns a function finding the index of the centroid
+// nearest to a pixel by dist, which must be the distance of opts, using a
+// kd-tree when there are many centroids
+func (opts *MosaicOptions) nearestCentroidFunc(centroids []Pixel, dist distanceFunc) func(Pixel) int {
+	if len(centroids) >= kdTreeThreshold {
+		tree := newKDTree(centroids, opts.DistanceWeights, dist)
+		return func(p Pixel) int {
+			i, _ := tree.nearest(p)
+			return i
+		}
+	}
+	return func(p Pixel) int {
+		return findNearestCentroidIndex(p, centroids, dist)
+	}
+}
@@ -0,0 +1,73 @@
+package mosaic
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// snappedPixels returns n random pixels with channels snapped to steps+1
+// levels when steps is positive, so that ties and duplicates are common
+func snappedPixels(rng *rand.Rand, n, steps int) []Pixel {
+	pixels := randomPixels(rng, n)
+	if steps > 0 {
+		for i, p := range pixels {
+			pixels[i] = snapPixel(p, steps)
+		}
+	}
+	return pixels
+}
+
+func TestKDTreeMatchesBruteForce(t *testing.T) {
+	tests := []struct {
+		name    string
+		k       int
+		steps   int
+		weights [3]float64
+	}{
+		{"single", 1, 0, [3]float64{}},
+		{"few", 5, 0, [3]float64{}},
+		{"many", 256, 0, [3]float64{}},
+		{"ties", 64, 3, [3]float64{}},
+		{"weighted", 100, 0, [3]float64{0.3, 0.59, 0.11}},
+		{"weighted ties", 100, 4, [3]float64{2, 1, 1}},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &MosaicOptions{DistanceWeights: tt.weights}
+			dist := opts.distanceFunc()
+			centroids := snappedPixels(rng, tt.k, tt.steps)
+			tree := newKDTree(centroids, tt.weights, dist)
+
+			for _, p := range snappedPixels(rng, 2000, tt.steps) {
+				want := findNearestCentroidIndex(p, centroids, dist)
+				got, d := tree.nearest(p)
+				if got != want {
+					t.Fatalf("nearest(%v) = %d (%v), want %d (%v)", p, got, centroids[got], want, centroids[want])
+				}
+				if d != dist(p, centroids[want]) {
+					t.Fatalf("nearest(%v) distance = %v, want %v", p, d, dist(p, centroids[want]))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNearestCentroid(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	centroids := randomPixels(rng, 256)
+	queries := randomPixels(rng, 1024)
+
+	b.Run("brute", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			findNearestCentroidIndex(queries[i%len(queries)], centroids, distanceSquared)
+		}
+	})
+	b.Run("kdtree", func(b *testing.B) {
+		tree := newKDTree(centroids, [3]float64{}, distanceSquared)
+		for i := 0; i < b.N; i++ {
+			tree.nearest(queries[i%len(queries)])
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+)
+
+// BlockLabels clusters the first region like CreateMosaic and returns the
+// palette index of each block instead of the rendered image, e.g. to count
+// the blocks of each color or build a mask. The grid has one row per block
+// origin down the region and one column per block origin across it, so
+// ceil(Height/BlockSize) rows of ceil(Width/BlockSize) entries. Blocks that
+// are not painted with a palette color, as with NoQuantize, PositionRamp or
+// blocks kept by EdgeAware, are labeled -1. Hexagonal layouts are labeled
+// on the square grid. When nothing is left to cluster, as with an inverted
+// region covering the whole image, every block is labeled -1 and the palette
+// is empty.
+func BlockLabels(img image.Image, opts *MosaicOptions) ([][]int, []color.RGBA) {
+	opts = opts.Normalize()
+	if len(opts.RegionSpecs) > 0 {
+		opts = opts.specOptions(opts.RegionSpecs[0])
+	}
+	grid := *opts.withInvertedRegions()
+	if grid.BlockLayout == LayoutHex {
+		grid.BlockLayout = LayoutGrid
+	}
+
+	region := grid.regions(img.Bounds())[0]
+	src := grid.preBlur(img, []*Region{region})
+	centroids, _ := clusterRegions(src, []*Region{region}, &grid)
+
+	stride := grid.blockStride()
+	bounds := image.Rect(0, 0, ceilDiv(region.Width, stride.X), ceilDiv(region.Height, stride.Y))
+	labels := make([][]int, bounds.Dy())
+	for y := range labels {
+		labels[y] = make([]int, bounds.Dx())
+		for x := range labels[y] {
+			labels[y][x] = -1
+		}
+	}
+
+	// With nothing to cluster no block is painted with a palette color
+	if len(centroids) == 0 {
+		return labels, nil
+	}
+
+	// Blocks are in scan order, so the block starting at a cell's origin is
+	// labeled after any overlapping block that covers it
+	rects := regionBlocks(src, region, &grid)
+	blocks := planRegion(src, region, rects, centroids, grid.distanceFunc(), &grid, nil)
+	for _, block := range blocks {
+		cells := blockCells(region, block.rect, stride).Intersect(bounds)
+		for cy := cells.Min.Y; cy < cells.Max.Y; cy++ {
+			for cx := cells.Min.X; cx < cells.Max.X; cx++ {
+				labels[cy][cx] = block.index
+			}
+		}
+	}
+
+	palette := make([]color.RGBA, len(centroids))
+	for i, c := range centroids {
+		palette[i] = grid.outputPixel(c).ToRGBA()
+	}
+	return labels, palette
+}
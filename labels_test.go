@@ -0,0 +1,114 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBlockLabels(t *testing.T) {
+	// Create a two-color split image whose width is not a multiple of the
+	// block size
+	img := image.NewRGBA(image.Rect(0, 0, 45, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 45; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 20 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		noQuantize bool
+	}{
+		{"quantized", false},
+		{"no quantize", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.K = 2
+			opts.NoQuantize = tt.noQuantize
+
+			labels, palette := BlockLabels(img, opts)
+
+			if len(labels) != 2 {
+				t.Fatalf("got %d rows, want 2", len(labels))
+			}
+			for _, row := range labels {
+				if len(row) != 5 {
+					t.Fatalf("got %d columns, want 5", len(row))
+				}
+				if tt.noQuantize {
+					for x, label := range row {
+						if label != -1 {
+							t.Errorf("column %d label = %d, want -1", x, label)
+						}
+					}
+					continue
+				}
+
+				left, right := row[0], row[2]
+				if left == right {
+					t.Errorf("left and right share label %d", left)
+				}
+				for x, label := range row {
+					want := left
+					if x >= 2 {
+						want = right
+					}
+					if label != want {
+						t.Errorf("column %d label = %d, want %d", x, label, want)
+					}
+				}
+				if palette[left] != (color.RGBA{R: 255, A: 255}) || palette[right] != (color.RGBA{B: 255, A: 255}) {
+					t.Errorf("palette[%d], palette[%d] = %v, %v, want red and blue", left, right, palette[left], palette[right])
+				}
+			}
+		})
+	}
+}
+
+func TestBlockLabelsNothingToCluster(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 25, 20))
+
+	tests := []struct {
+		name   string
+		modify func(*MosaicOptions)
+	}{
+		{"inverted whole image", func(o *MosaicOptions) {
+			o.Region = &Region{X: 0, Y: 0, Width: 25, Height: 20, Invert: true}
+		}},
+		{"fully transparent", func(o *MosaicOptions) { o.IgnoreTransparent = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(opts)
+
+			labels, palette := BlockLabels(img, opts)
+
+			if len(palette) != 0 {
+				t.Errorf("got %d palette colors, want 0", len(palette))
+			}
+			if len(labels) != 2 {
+				t.Fatalf("got %d rows, want 2", len(labels))
+			}
+			for y, row := range labels {
+				if len(row) != 3 {
+					t.Fatalf("got %d columns, want 3", len(row))
+				}
+				for x, label := range row {
+					if label != -1 {
+						t.Errorf("block (%d, %d) label = %d, want -1", x, y, label)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package mosaic
+
+import "time"
+
+// Logger receives progress messages, e.g. a *log.Logger. Messages are
+// single lines without a trailing newline.
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+// logf writes a message to the Logger, if any
+func (opts *MosaicOptions) logf(format string, args ...any) {
+	if opts.Logger != nil {
+		opts.Logger.Printf(format, args...)
+	}
+}
+
+// logPhase writes how long a phase took since start
+func (opts *MosaicOptions) logPhase(phase string, start time.Time) {
+	opts.logf("mosaic: %s took %v", phase, time.Since(start))
+}
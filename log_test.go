@@ -0,0 +1,48 @@
+package mosaic
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// captureLogger records every message it receives
+type captureLogger struct {
+	messages []string
+}
+
+func (l *captureLogger) Printf(format string, args ...any) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 12), G: uint8(y * 12), A: 255})
+		}
+	}
+
+	logger := &captureLogger{}
+	opts := DefaultOptions()
+	opts.K = 3
+	opts.Logger = logger
+	_, stats := CreateMosaicWithStats(img, opts)
+
+	want := []string{
+		fmt.Sprintf("clustered 3 colors in %d iterations", stats.IterationsRun),
+		"clustering took ",
+		"painting 4 blocks took ",
+	}
+	for _, w := range want {
+		found := false
+		for _, m := range logger.messages {
+			found = found || strings.Contains(m, w)
+		}
+		if !found {
+			t.Errorf("no message containing %q in %q", w, logger.messages)
+		}
+	}
+}
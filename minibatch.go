@@ -0,0 +1,73 @@
+package mosaic
+
+import "math/rand"
+
+// defaultBatchSize is the mini-batch size used when BatchSize is not positive
+const defaultBatchSize = 1024
+
+// miniBatchCentroids runs mini-batch k-means starting from the given
+// centroids. Each iteration assigns a random batch of pixels and moves every
+// centroid toward its assigned pixels with a learning rate that decays as the
+// centroid absorbs more pixels.
+func miniBatchCentroids(pixels []Pixel, centroids []Pixel, opts *MosaicOptions, rng *rand.Rand) ([]Pixel, *MosaicStats) {
+	k := len(centroids)
+	dist := opts.distanceFunc()
+	stats := &MosaicStats{}
+	initialDiff := 0.0 // largest centroid move of the first iteration
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	batch := make([]Pixel, batchSize)
+	assigned := make([]int, batchSize)
+	counts := make([]int, k)
+
+	for iteration := 0; iteration < opts.Iterations; iteration++ {
+		// Draw a batch and assign it against the current centroids
+		nearest := opts.nearestCentroidFunc(centroids, dist)
+		for j := range batch {
+			batch[j] = pixels[rng.Intn(len(pixels))]
+			assigned[j] = nearest(batch[j])
+		}
+
+		// Move centroids toward their assigned pixels
+		newCentroids := make([]Pixel, k)
+		copy(newCentroids, centroids)
+		sizes := make([]int, k)
+		for j, p := range batch {
+			i := assigned[j]
+			counts[i]++
+			sizes[i]++
+			eta := 1 / float64(counts[i])
+			c := &newCentroids[i]
+			c.R += eta * (p.R - c.R)
+			c.G += eta * (p.G - c.G)
+			c.B += eta * (p.B - c.B)
+		}
+
+		maxDiff := 0.0
+		for i := range centroids {
+			maxDiff = max(maxDiff, distance(centroids[i], newCentroids[i]))
+		}
+		centroids = newCentroids
+
+		stats.IterationsRun = iteration + 1
+		if opts.IterationFunc != nil {
+			opts.IterationFunc(iteration+1, centroids)
+		}
+		stats.FinalMaxDiff = maxDiff
+		if iteration == 0 {
+			initialDiff = maxDiff
+		}
+		stats.ClusterSizes = sizes
+
+		// Check for convergence
+		if opts.converged(stats.IterationsRun, maxDiff, initialDiff) {
+			stats.Converged = true
+			break
+		}
+	}
+
+	return centroids, stats
+}
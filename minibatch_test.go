@@ -0,0 +1,66 @@
+package mosaic
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestMiniBatchSeparatesClusters(t *testing.T) {
+	// Two clear clusters of noisy dark and light pixels
+	rng := rand.New(rand.NewSource(1))
+	pixels := make([]Pixel, 20000)
+	for i := range pixels {
+		base := 0.1
+		if i%2 == 1 {
+			base = 0.9
+		}
+		pixels[i] = Pixel{
+			R: base + (rng.Float64()-0.5)*0.1,
+			G: base + (rng.Float64()-0.5)*0.1,
+			B: base + (rng.Float64()-0.5)*0.1,
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.ClusterAlgorithm = AlgoMiniBatch
+	opts.BatchSize = 256
+
+	centroids, _ := kmeans(pixels, opts)
+	sort.Slice(centroids, func(i, j int) bool { return centroids[i].R < centroids[j].R })
+
+	want := []Pixel{{R: 0.1, G: 0.1, B: 0.1}, {R: 0.9, G: 0.9, B: 0.9}}
+	for i := range want {
+		if d := distance(centroids[i], want[i]); d > 0.05 {
+			t.Errorf("centroid %d = %v, want near %v", i, centroids[i], want[i])
+		}
+	}
+}
+
+func BenchmarkClusterAlgorithm(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	pixels := make([]Pixel, 1024*1024)
+	for i := range pixels {
+		pixels[i] = Pixel{R: rng.Float64(), G: rng.Float64(), B: rng.Float64()}
+	}
+
+	algos := []struct {
+		name string
+		algo ClusterAlgorithm
+	}{
+		{"Lloyd", AlgoLloyd},
+		{"MiniBatch", AlgoMiniBatch},
+	}
+
+	for _, tt := range algos {
+		b.Run(tt.name, func(b *testing.B) {
+			opts := DefaultOptions()
+			opts.ClusterAlgorithm = tt.algo
+			opts.Iterations = 10
+			for i := 0; i < b.N; i++ {
+				kmeans(pixels, opts)
+			}
+		})
+	}
+}
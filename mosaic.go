@@ -1,13 +1,18 @@
 package mosaic
 
 import (
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
+	"image/color/palette"
 	"image/draw"
+	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"math"
 	"math/rand"
+	"time"
 )
 
 // Pixel represents a single pixel with RGB values
@@ -21,8 +26,75 @@ type Region struct {
 	Y      int // y-coordinate of top-left corner
 	Width  int // width of the region
 	Height int // height of the region
+
+	// Invert applies the mosaic to the whole image except this rectangle,
+	// which keeps its original pixels. It ignores Angle and Shape.
+	Invert bool
+
+	// Angle rotates the region clockwise about its top-left corner, in
+	// radians, e.g. for tilted text on scans. Blocks stay axis-aligned and
+	// are masked to the rotated rectangle.
+	Angle float64
+
+	// Shape limits the region to the ellipse inscribed in its rectangle with
+	// ShapeEllipse, e.g. to redact a face. Pixels outside the ellipse keep
+	// their original colors and are left out of block colors.
+	Shape RegionShape
+
+	mask *Region // the rotated or elliptical region a resolved bounding box masks to
 }
 
+// RegionShape selects the area of its rectangle a region covers
+type RegionShape int
+
+const (
+	ShapeRect    RegionShape = iota // the whole rectangle
+	ShapeEllipse                    // the ellipse inscribed in the rectangle
+)
+
+// BlockShape selects the shape painted for each mosaic block
+type BlockShape int
+
+const (
+	BlockSquare BlockShape = iota // fill the whole block cell
+	BlockCircle                   // fill a circle inscribed in the block cell
+)
+
+// BlockLayout selects how mosaic cells tile a region
+type BlockLayout int
+
+const (
+	LayoutGrid    BlockLayout = iota // square blocks on a regular grid
+	LayoutHex                        // hexagonal cells in rows offset by half a cell
+	LayoutHStripe                    // horizontal stripes spanning the region width
+	LayoutVStripe                    // vertical stripes spanning the region height
+)
+
+// ClusterAlgorithm selects how the k-means palette is computed
+type ClusterAlgorithm int
+
+const (
+	AlgoLloyd     ClusterAlgorithm = iota // assign every pixel in each iteration
+	AlgoMiniBatch                         // update from a random batch of pixels in each iteration
+)
+
+// InitMethod selects how the initial k-means centroids are picked
+type InitMethod int
+
+const (
+	InitRandom        InitMethod = iota // random pixels
+	InitFixedSampling                   // pixels evenly spaced through the region
+	InitPlusPlus                        // k-means++: random pixels favoring those far from earlier picks
+)
+
+// ConvergenceMode selects how Tolerance decides that k-means has converged
+type ConvergenceMode int
+
+const (
+	ConvergenceAbsolute ConvergenceMode = iota // stop when centroids move less than Tolerance
+	ConvergenceRelative                        // stop when centroids move less than Tolerance times their first move
+)
+
 // MosaicOptions contains configuration for mosaic generation
 type MosaicOptions struct {
 	K          int     // number of colors for k-means
@@ -30,6 +102,313 @@ type MosaicOptions struct {
 	Iterations int     // number of k-means iterations
 	Tolerance  float64 // convergence tolerance
 	Region     *Region // region to apply mosaic effect (nil for entire image)
+
+	// ConvergenceMode is how Tolerance is applied. ConvergenceRelative
+	// compares centroid moves to the first iteration's move, so the same
+	// Tolerance behaves alike on low- and high-contrast images.
+	ConvergenceMode ConvergenceMode
+
+	// MinIterations is the number of k-means iterations that always run
+	// before Tolerance may stop clustering, so poorly placed initial colors
+	// are refined even on near-uniform images. It is capped by Iterations.
+	// Zero lets the first iteration converge.
+	MinIterations int
+
+	// Regions lists several areas to apply the mosaic effect to. When
+	// non-empty it takes precedence over Region. All regions share one
+	// palette clustered from their combined pixels, and later regions win
+	// where they overlap.
+	Regions []*Region
+
+	// RegionSpecs lists regions with their own K, BlockSize or Palette, e.g.
+	// to pixelate a face heavily but a license plate lightly. When non-empty
+	// it takes precedence over Region and Regions. Each spec is clustered on
+	// its own, and later specs win where they overlap.
+	RegionSpecs []RegionSpec
+
+	// BlockWidth and BlockHeight, when positive, override BlockSize for the
+	// width and height of grid blocks, e.g. for tall or wide tiles
+	BlockWidth  int
+	BlockHeight int
+
+	// BlockStride is the distance between the origins of adjacent blocks.
+	// A stride smaller than BlockSize makes blocks overlap, and pixels
+	// covered by several blocks are averaged across them.
+	// Zero defaults to BlockSize (no overlap).
+	BlockStride int
+
+	// BlockJitter shifts the blocks of each row of a LayoutGrid right by a
+	// random amount of up to BlockJitter pixels (at most one block), seeded
+	// by Seed, breaking up the regular grid for an organic look. A partial
+	// block fills the start of a shifted row. Zero keeps rows aligned.
+	BlockJitter int
+
+	// FillBackground, when non-nil, paints pixels of the region that are not
+	// covered by a block shape with this color instead of keeping the
+	// original image.
+	FillBackground *color.RGBA
+
+	// DistanceWeights scales the squared R, G and B differences when
+	// measuring color distance, e.g. {1, 2, 1} to weight green like
+	// luminance perception does. The zero value means {1, 1, 1}.
+	DistanceWeights [3]float64
+
+	// Palette, when non-empty, is used as the fixed set of block colors
+	// instead of clustering the image; K is ignored. ReadPalette loads one
+	// saved with WritePalette.
+	Palette Palette
+
+	// BlockSample is how a block's color is derived from its pixels before
+	// it is matched to a palette color. SampleCenter and SampleMedian give
+	// sharper results since they pick colors actual pixels have, and
+	// SampleMostSaturated keeps vivid colors that averaging would dull. It
+	// applies to rectangular block layouts.
+	BlockSample BlockSample
+
+	// NoQuantize fills each block with its own sampled color (the average by
+	// default) instead of the nearest of K clustered colors, the classic
+	// pixelate filter. Clustering
+	// is skipped, so K, Palette and Dither are ignored.
+	NoQuantize bool
+
+	// Posterize maps every pixel of the regions to its nearest clustered
+	// color on its own, a smooth palette-reduced image without any blocks.
+	// Block options such as BlockSize and BlockLayout are ignored, as is
+	// Posterize itself with NoQuantize or PositionRamp.
+	Posterize bool
+
+	// PositionRamp, when non-empty, colors each block from this ramp by its
+	// horizontal position within the region (first color on the left, last
+	// color on the right) instead of by the image content. Clustering is
+	// skipped in this mode. The block structure still follows the image:
+	// PositionRamp implies AdaptiveBlocks, so busy areas get smaller blocks
+	// (a large VarianceThreshold keeps the regular grid).
+	PositionRamp []color.RGBA
+
+	// BlockLayout is how cells tile the region. LayoutHex paints a honeycomb
+	// of hexagonal cells BlockSize wide, and ignores BlockStride, BlockShape,
+	// AdaptiveBlocks, Dither, GridLines and CollapseBlocks. LayoutHStripe
+	// and LayoutVStripe paint a venetian-blind effect of stripes spanning the
+	// region, BlockHeight tall or BlockWidth wide respectively.
+	BlockLayout BlockLayout
+
+	// BlockShape is the shape painted for each block. Pixels of a block cell
+	// outside the shape keep the original image (or FillBackground).
+	BlockShape BlockShape
+
+	// AdaptiveBlocks splits blocks into quadrants (quadtree style) while the
+	// variance of their pixels exceeds VarianceThreshold, down to
+	// MinBlockSize. Busy areas get small blocks and flat areas stay large.
+	// BlockStride is ignored in this mode.
+	AdaptiveBlocks    bool
+	MinBlockSize      int     // smallest block size produced by subdivision (zero for the default)
+	VarianceThreshold float64 // pixel variance above which a block is subdivided
+
+	// DensityMap, when non-nil, sets the local block size from a grayscale
+	// map stretched over the image: black areas get MinBlockSize blocks,
+	// white areas BlockSize blocks, and grays sizes in between. It takes
+	// precedence over AdaptiveBlocks.
+	DensityMap image.Image
+
+	// DrawEdges overlays the edges of the original image, detected with a
+	// Sobel filter, on top of the mosaic for a comic-book look
+	DrawEdges     bool
+	EdgeThreshold float64     // gradient magnitude above which a pixel is an edge
+	EdgeColor     color.Color // color of drawn edges (nil for black)
+
+	// EdgeAware leaves blocks containing a pixel whose Sobel gradient
+	// magnitude exceeds EdgeThreshold at their original resolution, so
+	// silhouettes stay crisp while flat areas are mosaicked. It applies to
+	// rectangular block layouts.
+	EdgeAware bool
+
+	// GridLines draws lines of GridWidth pixels in GridColor along the
+	// boundaries between blocks, clipped to the region
+	GridLines bool
+	GridColor color.Color // color of grid lines (nil for black)
+	GridWidth int         // width of grid lines in pixels (0 for 1)
+
+	// Opacity blends the painted mosaic over the original image for a
+	// translucent overlay: each pixel becomes Opacity*mosaic +
+	// (1-Opacity)*original. Zero is the unset value and defaults to 1
+	// (fully opaque), so it does not leave the image untouched as the
+	// formula suggests; values just above zero give a faint overlay.
+	Opacity float64
+
+	// FeatherRadius fades the mosaic into the original over this many
+	// pixels inside each region's border, with the mosaic's weight ramping
+	// linearly from 0 at the border to full at FeatherRadius inside. Borders
+	// on the image edge are not feathered. Zero keeps hard edges.
+	FeatherRadius int
+
+	// ClusterAlgorithm is the k-means variant used to compute the palette.
+	// AlgoMiniBatch is much faster on very large images at a small cost in
+	// palette quality.
+	ClusterAlgorithm ClusterAlgorithm
+
+	// InitMethod is how initial centroids are picked. InitFixedSampling
+	// samples pixels evenly spaced through the region in scan order, so the
+	// same image always gets the same palette, e.g. across a photo series.
+	InitMethod InitMethod
+
+	// Seed, when non-zero, seeds the random choices of clustering
+	// (InitRandom, InitPlusPlus and AlgoMiniBatch) and BlockJitter, so the
+	// same image and options always give the same mosaic
+	Seed int64
+
+	// Workers splits the pixel assignment step of each k-means iteration
+	// across this many goroutines, each summing its own share of the
+	// clusters. As sums are added in another order, centroids may differ
+	// from serial ones in the last bits. It applies to AlgoLloyd without
+	// UseHistogram. Zero or one assigns serially.
+	Workers int
+
+	// BatchSize is the number of pixels drawn per iteration by AlgoMiniBatch
+	// (default: 1024)
+	BatchSize int
+
+	// MergeThreshold, when positive, merges clustered colors closer than this
+	// distance (in 0-1 RGB units) into their size-weighted average, reducing
+	// K automatically for simple images
+	MergeThreshold float64
+
+	// PreBlurRadius, when positive, box-blurs a working copy of each region
+	// with this radius before clustering and block sampling, smoothing the
+	// palette and blocks of noisy photos. Pixels outside the regions are
+	// neither changed nor blurred in.
+	PreBlurRadius int
+
+	// SampleRate, when in (0, 1), clusters only this fraction of the pixels
+	// (picked at an even stride) to speed up k-means on large images.
+	// Block colors are still averaged over every pixel.
+	SampleRate float64
+
+	// UseHistogram clusters the mean colors of a 6-bit-per-channel color
+	// histogram, each weighted by its pixel count raised to WeightPower,
+	// instead of every pixel. It is much faster on large images. A
+	// WeightPower below 1 reduces the pull of large flat areas on the
+	// palette (0 for 1, weighting by plain pixel count).
+	UseHistogram bool
+	WeightPower  float64
+
+	// SortByHue orders clustered colors by hue, then saturation, then value,
+	// so palettes of similar images list their colors alike. It applies to
+	// MosaicStats, ExtractPalette (instead of most common first) and
+	// BlockLabels.
+	SortByHue bool
+
+	// CentroidCacheBits, when positive, caches the nearest centroid of block
+	// averages quantized to this many bits per channel (5 is a good choice).
+	// Blocks with similar averages, common in flat or posterized images,
+	// then skip the centroid search at the cost of a tiny approximation.
+	CentroidCacheBits int
+
+	// PruneUnused drops centroids that no block was painted with from the
+	// palettes reported in MosaicStats and by ExtractPalette
+	PruneUnused bool
+
+	// PaletteSnapGrid, when positive, snaps clustered colors to a coarse grid
+	// with this many steps per channel, so that visually similar images
+	// produce identical palettes
+	PaletteSnapGrid int
+
+	// GuidePalette pulls each clustered color to its nearest guide color when
+	// that lies within GuideStrength (a distance in 0-1 RGB units), e.g. to
+	// keep brand colors exact. Colors with no guide close enough are kept.
+	GuidePalette  []color.RGBA
+	GuideStrength float64
+
+	// ExcludeColors leaves pixels within ExcludeTolerance (a distance in 0-1
+	// RGB units, 0 for exact matches) of these colors out of clustering, so
+	// e.g. the white paper and black text of a scan do not use up K. Blocks
+	// are still painted with the nearest clustered color, or with
+	// KeepExcluded the matching pixels keep their original colors. If every
+	// pixel matches, all of them are clustered.
+	ExcludeColors    []color.RGBA
+	ExcludeTolerance float64
+	KeepExcluded     bool
+
+	// ProgressFunc, when non-nil, is called from the calling goroutine each
+	// time a block is completed, with total being the number of blocks
+	ProgressFunc func(done, total int)
+
+	// IterationFunc, when non-nil, is called after each k-means iteration
+	// with the iteration number (from 1) and the current centroids, which
+	// are in linear light when LinearizeGamma is set. The centroids must
+	// not be modified.
+	IterationFunc func(iteration int, centroids []Pixel)
+
+	// Logger, when non-nil, receives messages with the time taken by
+	// clustering and painting and the number of k-means iterations run
+	Logger Logger
+
+	// FrameDelay is the delay between RenderIterations frames in 100ths of
+	// a second (default: 50)
+	FrameDelay int
+
+	// CMYKHalftone renders each region in the comic-book style instead of
+	// quantizing it: the image is separated into cyan, magenta, yellow and
+	// black, and each ink is printed as dots on a BlockSize screen rotated
+	// by its ScreenAngles entry, with dot area following the ink coverage
+	CMYKHalftone bool
+
+	// ScreenAngles are the C, M, Y and K screen angles in degrees for
+	// CMYKHalftone. The zero value means the classic {15, 75, 0, 45}.
+	ScreenAngles [4]float64
+
+	// CollapseBlocks outputs one pixel per block of the first region instead
+	// of the full-size mosaic, e.g. for thumbnails. The image has one column
+	// per block origin across the region and one row per block origin down it.
+	CollapseBlocks bool
+
+	// Dither diffuses each block's quantization error to its neighbors
+	// (Floyd–Steinberg across the block grid), breaking up banding on
+	// gradients. It is ignored with AdaptiveBlocks and DensityMap.
+	Dither bool
+
+	// ColorTransform, when non-nil, is applied to every pixel before it is
+	// clustered or averaged, e.g. for tone curves or channel swaps
+	ColorTransform func(Pixel) Pixel
+
+	// LinearizeGamma clusters and averages pixels in linear light instead of
+	// sRGB, so that mixed blocks are not too dark (red and green average to
+	// yellow rather than olive). Block colors are converted back to sRGB.
+	LinearizeGamma bool
+
+	// Grayscale converts pixels to their luminance before clustering, so the
+	// mosaic is made of gray blocks (a clean tonal posterize)
+	Grayscale bool
+
+	// SaturationScale and BrightnessScale multiply the HSV saturation and
+	// value of block colors after clustering, e.g. for a punchy poster look.
+	// Clustering still uses the original colors, and a fixed Palette is
+	// painted as given. Zero defaults to 1 (no change).
+	SaturationScale float64
+	BrightnessScale float64
+
+	// IgnoreTransparent skips pixels with an alpha below AlphaThreshold when
+	// clustering and computing block colors, so transparent backgrounds do
+	// not pollute the palette. Blocks with no visible pixels are left
+	// untouched.
+	IgnoreTransparent bool
+	AlphaThreshold    uint8 // alpha below which a pixel is skipped (0 for 1, skipping only fully transparent pixels)
+
+	// PreserveBoxes lists rectangles (e.g. text bounding boxes) that are
+	// excluded from mosaicking even inside a region. Their pixels keep the
+	// original image and do not contribute to clustering or block colors.
+	PreserveBoxes []image.Rectangle
+
+	// AutoKeyBackground detects the most common color along the image border
+	// and makes output pixels within KeyTolerance of it transparent.
+	AutoKeyBackground bool
+	KeyTolerance      float64 // color distance within which pixels are keyed out
+
+	buffers   *buffers // slices reused across calls by a Mosaicker (nil for none)
+	centroids []Pixel  // colors clustered up front by ProcessTiled (nil to cluster)
+
+	// gridOrigin is the origin of the whole region's block grid when
+	// ProcessTiled paints a tile of it (nil for the region's own origin)
+	gridOrigin *image.Point
 }
 
 // DefaultOptions returns default mosaic options
@@ -40,115 +419,1010 @@ func DefaultOptions() *MosaicOptions {
 		Iterations: 50,
 		Tolerance:  0.001,
 		Region:     nil,
+		BatchSize:  1024,
+		FrameDelay: 50,
+
+		DistanceWeights: [3]float64{1, 1, 1},
+		KeyTolerance:    0.05,
+
+		MinBlockSize:      2,
+		VarianceThreshold: 0.01,
+		EdgeThreshold:     0.5,
 	}
 }
 
+// MosaicStats reports how the k-means clustering of a mosaic went
+type MosaicStats struct {
+	IterationsRun int     // number of k-means iterations performed
+	Converged     bool    // whether centroid movement fell below Tolerance
+	FinalMaxDiff  float64 // largest centroid movement in the last iteration
+	ClusterSizes  []int   // number of pixels assigned to each centroid
+
+	// Palette holds the centroid colors, in the same order as ClusterSizes.
+	// With PruneUnused it only holds the colors painted by some block.
+	Palette []color.RGBA
+
+	// ColorsUsed is the number of distinct centroids painted by some block,
+	// which may be less than K
+	ColorsUsed int
+}
+
 // CreateMosaic creates a mosaic image from the input image using k-means clustering
 func CreateMosaic(img image.Image, opts *MosaicOptions) image.Image {
-	if opts == nil {
-		opts = DefaultOptions()
+	mosaic, _ := CreateMosaicWithStats(img, opts)
+	return mosaic
+}
+
+// CreateMosaicRGBA creates a mosaic like CreateMosaic and returns it as an
+// *image.RGBA, converting outputs that keep another color model of the input
+func CreateMosaicRGBA(img image.Image, opts *MosaicOptions) *image.RGBA {
+	mosaic := CreateMosaic(img, opts)
+	if rgba, ok := mosaic.(*image.RGBA); ok {
+		return rgba
+	}
+
+	bounds := mosaic.Bounds()
+	rgba := image.NewRGBA(bounds)
+	draw.Draw(rgba, bounds, mosaic, bounds.Min, draw.Src)
+	return rgba
+}
+
+// maxPalettedColors is the most colors the uint8 indices of an
+// image.Paletted can address
+const maxPalettedColors = 256
+
+// CreateMosaicPaletted creates a mosaic like CreateMosaic and returns it as
+// an *image.Paletted, e.g. for gif.Encode, whose palette is the colors blocks
+// are painted with. As a paletted image holds at most 256 colors, K and a
+// fixed Palette are clamped to 256, keeping the first colors of the palette.
+// RegionSpecs share the 256 colors evenly, so each spec's K and Palette are
+// clamped to its share. Pixels outside the mosaic regions take the nearest
+// palette color. Without clustered colors, as with NoQuantize, PositionRamp
+// or CMYKHalftone, the Plan 9 palette is used.
+func CreateMosaicPaletted(img image.Image, opts *MosaicOptions) *image.Paletted {
+	opts = opts.Normalize()
+	clamped := *opts
+	clamped.K = min(clamped.K, maxPalettedColors)
+	clamped.Palette = clamped.Palette[:min(len(clamped.Palette), maxPalettedColors)]
+	clamped.PruneUnused = true
+	if n := len(clamped.RegionSpecs); n > 0 {
+		share := max(1, maxPalettedColors/n)
+		clamped.RegionSpecs = append([]RegionSpec(nil), clamped.RegionSpecs...)
+		for i := range clamped.RegionSpecs {
+			spec := &clamped.RegionSpecs[i]
+			if spec.K == 0 {
+				spec.K = clamped.K
+			}
+			spec.K = min(spec.K, share)
+			spec.Palette = spec.Palette[:min(len(spec.Palette), share)]
+		}
 	}
 
+	mosaic, stats := CreateMosaicWithStats(img, &clamped)
+
+	colors := color.Palette(palette.Plan9)
+	if len(stats.Palette) > 0 {
+		// Regions painted with the same colors list them more than once
+		colors = make(color.Palette, 0, len(stats.Palette))
+		seen := make(map[color.RGBA]bool, len(stats.Palette))
+		for _, c := range stats.Palette {
+			if !seen[c] && len(colors) < maxPalettedColors {
+				seen[c] = true
+				colors = append(colors, c)
+			}
+		}
+	}
+
+	bounds := mosaic.Bounds()
+	paletted := image.NewPaletted(bounds, colors)
+	draw.Draw(paletted, bounds, mosaic, bounds.Min, draw.Src)
+	return paletted
+}
+
+// CreateMosaicWithStats creates a mosaic like CreateMosaic and also reports
+// statistics about the k-means clustering
+func CreateMosaicWithStats(img image.Image, opts *MosaicOptions) (image.Image, *MosaicStats) {
+	opts = opts.Normalize()
+
+	mosaic := newOutputImage(img, opts)
+	collapsed, stats := renderMosaic(mosaic, img, opts, true)
+	if collapsed != nil {
+		return collapsed, stats
+	}
+	return mosaic, stats
+}
+
+// CreateMosaicInto paints the mosaic blocks of img's regions into dst and
+// leaves every pixel of dst outside the regions untouched, so several calls
+// with different regions or palettes can be layered on one canvas. dst
+// should already hold the base image if the surroundings are wanted. It
+// returns an error if the bounds of dst and img differ or CollapseBlocks is
+// set.
+func CreateMosaicInto(dst *image.RGBA, img image.Image, opts *MosaicOptions) error {
+	if dst.Bounds() != img.Bounds() {
+		return fmt.Errorf("mosaic: destination bounds %v do not match source bounds %v", dst.Bounds(), img.Bounds())
+	}
+	opts = opts.Normalize()
+	if opts.CollapseBlocks {
+		return errors.New("mosaic: CollapseBlocks is not supported by CreateMosaicInto")
+	}
+
+	renderMosaic(dst, img, opts, false)
+	return nil
+}
+
+// renderMosaic applies the mosaic effect to mosaic, which must have the same
+// bounds as img. With copySource img is first copied into mosaic; without
+// it, pixels outside the regions are left as they are. With CollapseBlocks
+// the collapsed image is returned instead and mosaic holds only the copy.
+func renderMosaic(mosaic draw.Image, img image.Image, opts *MosaicOptions, copySource bool) (*image.RGBA, *MosaicStats) {
+	opts = opts.withInvertedRegions()
+
 	bounds := img.Bounds()
-	region := opts.Region
-	if region == nil {
-		region = &Region{
-			X:      bounds.Min.X,
-			Y:      bounds.Min.Y,
-			Width:  bounds.Dx(),
-			Height: bounds.Dy(),
+	regions := opts.regions(bounds)
+	if opts.CollapseBlocks {
+		regions = regions[:1]
+	}
+
+	// Start from a copy of the original
+	if copySource {
+		draw.Draw(mosaic, bounds, img, bounds.Min, draw.Src)
+	}
+
+	var stats *MosaicStats
+	if opts.CMYKHalftone {
+		stats = &MosaicStats{}
+		for _, region := range regions {
+			drawHalftone(region.target(mosaic), img, region, opts)
+		}
+	} else {
+		var collapsed *image.RGBA
+		if len(opts.RegionSpecs) > 0 {
+			collapsed, stats = paintSpecs(mosaic, img, regions, opts)
+		} else {
+			collapsed, stats = paintMosaic(mosaic, img, regions, opts)
 		}
+		if collapsed != nil {
+			return collapsed, stats
+		}
+	}
+
+	if opts.KeepExcluded && len(opts.ExcludeColors) > 0 {
+		restoreExcluded(mosaic, img, regions, opts)
 	}
 
-	// Validate region
-	if region.X < bounds.Min.X || region.Y < bounds.Min.Y ||
-		region.X+region.Width > bounds.Max.X || region.Y+region.Height > bounds.Max.Y {
-		// If invalid region, use entire image
-		region = &Region{
-			X:      bounds.Min.X,
-			Y:      bounds.Min.Y,
-			Width:  bounds.Dx(),
-			Height: bounds.Dy(),
+	if (opts.Opacity > 0 && opts.Opacity < 1) || opts.FeatherRadius > 0 {
+		opacity := opts.Opacity
+		if opacity <= 0 {
+			opacity = 1
 		}
+		blendOpacity(mosaic, img, regions, opacity, opts.FeatherRadius)
 	}
 
-	// Create output image (copy of original)
-	mosaic := image.NewRGBA(bounds)
-	draw.Draw(mosaic, bounds, img, bounds.Min, draw.Src)
+	if opts.DrawEdges {
+		edgeColor := opts.EdgeColor
+		if edgeColor == nil {
+			edgeColor = color.Black
+		}
+		for _, region := range regions {
+			drawEdges(region.target(mosaic), img, region, opts.EdgeThreshold, edgeColor)
+		}
+	}
 
-	// Convert specified region to pixels
-	pixels := imageToPixels(img, region)
+	// Restore preserved boxes from the original image
+	for _, box := range opts.PreserveBoxes {
+		if copySource {
+			draw.Draw(mosaic, box.Intersect(bounds), img, box.Intersect(bounds).Min, draw.Src)
+			continue
+		}
+		for _, region := range regions {
+			r := box.Intersect(region.rect())
+			draw.Draw(region.target(mosaic), r, img, r.Min, draw.Src)
+		}
+	}
+
+	if opts.AutoKeyBackground {
+		key := detectBackground(img)
+		if copySource {
+			keyColor(mosaic, bounds, key, opts.KeyTolerance)
+		} else {
+			for _, region := range regions {
+				keyColor(region.target(mosaic), region.rect(), key, opts.KeyTolerance)
+			}
+		}
+	}
+
+	return nil, stats
+}
+
+// paintMosaic clusters the regions and paints their blocks into mosaic. With
+// CollapseBlocks it paints nothing and returns the collapsed image instead.
+func paintMosaic(mosaic draw.Image, img image.Image, regions []*Region, opts *MosaicOptions) (*image.RGBA, *MosaicStats) {
+	// Colors are read from a blurred working copy when PreBlurRadius is set
+	src := opts.preBlur(img, regions)
 
 	// Perform k-means clustering
-	centroids := kmeans(pixels, opts.K, opts.Iterations, opts.Tolerance)
-
-	// Process each block within the specified region
-	for y := region.Y; y < region.Y+region.Height; y += opts.BlockSize {
-		for x := region.X; x < region.X+region.Width; x += opts.BlockSize {
-			// Calculate average color for the block
-			blockPixels := make([]Pixel, 0)
-			for by := 0; by < opts.BlockSize && y+by < region.Y+region.Height; by++ {
-				for bx := 0; bx < opts.BlockSize && x+bx < region.X+region.Width; bx++ {
-					r, g, b, _ := img.At(x+bx, y+by).RGBA()
-					blockPixels = append(blockPixels, Pixel{
-						R: float64(r) / 65535,
-						G: float64(g) / 65535,
-						B: float64(b) / 65535,
-					})
-				}
+	dist := opts.distanceFunc()
+	start := time.Now()
+	centroids, stats := clusterRegions(src, regions, opts)
+	opts.logf("mosaic: clustered %d colors in %d iterations (converged: %v)", len(centroids), stats.IterationsRun, stats.Converged)
+	opts.logPhase("clustering", start)
+
+	// With nothing to cluster the image is left as it is
+	if len(centroids) == 0 && len(opts.PositionRamp) == 0 && !opts.NoQuantize {
+		return nil, stats
+	}
+
+	used := make([]bool, len(centroids))
+	if opts.Posterize && len(opts.PositionRamp) == 0 && !opts.NoQuantize {
+		start = time.Now()
+		for _, region := range regions {
+			posterizeRegion(region.target(mosaic), src, region, centroids, used, dist, opts)
+		}
+		opts.logPhase("posterizing", start)
+		stats.recordUsage(centroids, used, opts)
+		return nil, stats
+	}
+
+	// Lay out the blocks of every region up front to know the total count
+	layouts := make([][]image.Rectangle, len(regions))
+	total := 0
+	for i, region := range regions {
+		if opts.BlockLayout == LayoutHex {
+			total += len(newHexGrid(region, opts.BlockSize).centers)
+			continue
+		}
+		layouts[i] = regionBlocks(src, region, opts)
+		total += len(layouts[i])
+	}
+	prog := newProgress(opts.ProgressFunc, total)
+	start = time.Now()
+	defer opts.logPhase(fmt.Sprintf("painting %d blocks", total), start)
+
+	// Mosaic regions in order, so later regions win where they overlap
+	for i, region := range regions {
+		if opts.BlockLayout == LayoutHex {
+			paintHexRegion(region.target(mosaic), src, region, centroids, used, dist, opts, prog)
+			continue
+		}
+		blocks := planRegion(src, region, layouts[i], centroids, dist, opts, prog)
+		for _, block := range blocks {
+			if block.index >= 0 {
+				used[block.index] = true
+			}
+		}
+		if opts.CollapseBlocks {
+			stats.recordUsage(centroids, used, opts)
+			return collapseBlocks(region, blocks, opts.blockStride()), stats
+		}
+		paintRegion(region.target(mosaic), img, region, blocks, opts)
+	}
+
+	stats.recordUsage(centroids, used, opts)
+	return nil, stats
+}
+
+// recordUsage fills in the palette and the number of colors used by the
+// painted blocks, dropping unused centroids with PruneUnused
+func (s *MosaicStats) recordUsage(centroids []Pixel, used []bool, opts *MosaicOptions) {
+	var palette []color.RGBA
+	var sizes []int
+	for i, c := range centroids {
+		if used[i] {
+			s.ColorsUsed++
+		} else if opts.PruneUnused {
+			continue
+		}
+		palette = append(palette, opts.outputPixel(c).ToRGBA())
+		if i < len(s.ClusterSizes) {
+			sizes = append(sizes, s.ClusterSizes[i])
+		}
+	}
+
+	s.Palette = palette
+	if opts.PruneUnused && s.ClusterSizes != nil {
+		s.ClusterSizes = sizes
+	}
+}
+
+// clusterRegions performs k-means clustering over all regions together so
+// that they share a single palette. No clustering is needed, and nil
+// centroids are returned, when block colors come from PositionRamp or
+// NoQuantize.
+func clusterRegions(img image.Image, regions []*Region, opts *MosaicOptions) ([]Pixel, *MosaicStats) {
+	if len(opts.PositionRamp) > 0 || opts.NoQuantize {
+		return nil, &MosaicStats{}
+	}
+	if len(opts.Palette) > 0 {
+		return opts.paletteCentroids(), &MosaicStats{}
+	}
+	if opts.centroids != nil {
+		return opts.centroids, &MosaicStats{}
+	}
+
+	pixels := opts.buffers.pixelSlice()
+	for _, region := range regions {
+		pixels = opts.appendPixels(pixels, img, region)
+	}
+	opts.buffers.keepPixels(pixels)
+	return kmeans(pixels, opts)
+}
+
+// paletteCentroids converts the fixed Palette to centroids
+func (opts *MosaicOptions) paletteCentroids() []Pixel {
+	return opts.clusterColors(opts.Palette)
+}
+
+// clusterColors converts colors to pixels in the color space pixels are
+// clustered in
+func (opts *MosaicOptions) clusterColors(colors []color.RGBA) []Pixel {
+	pixels := make([]Pixel, len(colors))
+	for i, c := range colors {
+		pixels[i] = rgbaToPixel(c)
+		if opts.LinearizeGamma {
+			pixels[i] = linearizePixel(pixels[i])
+		}
+	}
+	return pixels
+}
+
+// mosaicBlock is a block of the mosaic and the color it is painted with
+type mosaicBlock struct {
+	rect  image.Rectangle
+	index int // index of the assigned centroid, or -1 if none
+	color Pixel
+	keep  bool // left at original resolution because it straddles an edge
+}
+
+// planRegion computes the colors of the blocks laid out over a region,
+// reporting each completed block to prog
+func planRegion(img image.Image, region *Region, rects []image.Rectangle, centroids []Pixel, dist distanceFunc, opts *MosaicOptions, prog *progress) []mosaicBlock {
+	blocks := make([]mosaicBlock, len(rects))
+
+	cache := newCentroidCache(opts.CentroidCacheBits)
+	nearest := opts.nearestCentroidFunc(centroids, dist)
+
+	// Tiny blocks are averaged in a single downscaling pass. Otherwise each
+	// block's pixels are read into a reused buffer.
+	averages := newBlockAverages(img, region, opts)
+	var blockPixels []Pixel
+	sample := func(rect image.Rectangle) Pixel {
+		if averages != nil {
+			return averages.at(rect)
+		}
+		block := blockRegion(region, rect)
+		blockPixels = opts.appendPixels(blockPixels[:0], img, block)
+		return opts.sampleBlock(img, block, blockPixels)
+	}
+	invisible := func(rect image.Rectangle) bool {
+		blockPixels = opts.appendPixels(blockPixels[:0], img, blockRegion(region, rect))
+		return len(blockPixels) == 0
+	}
+
+	var dither *ditherBuffer
+	if opts.Dither && !opts.variableBlocks() && !opts.NoQuantize {
+		dither = newDitherBuffer(opts.blockStride())
+	}
+
+	for i, rect := range rects {
+		blocks[i] = mosaicBlock{rect: rect, index: -1}
+		if opts.IgnoreTransparent && invisible(rect) {
+			// Fully transparent blocks are left untouched
+			blocks[i].keep = true
+		} else if opts.EdgeAware && hasEdge(img, blockRegion(region, rect), opts.EdgeThreshold) {
+			// Collapsed output still needs a color for the block
+			blocks[i].keep = true
+			blocks[i].color = opts.outputPixel(sample(rect))
+		} else if len(opts.PositionRamp) > 0 {
+			blocks[i].color = rampColor(opts.PositionRamp, region, rect)
+		} else if opts.NoQuantize {
+			blocks[i].color = opts.outputPixel(sample(rect))
+		} else {
+			// Find the centroid nearest to the block's sampled color
+			avg := sample(rect)
+			if dither != nil {
+				avg = dither.adjust(rect.Min, avg)
+			}
+			blocks[i].index = cache.nearestIndex(avg, nearest)
+			if dither != nil {
+				dither.diffuse(rect.Min, avg, centroids[blocks[i].index])
 			}
+			blocks[i].color = opts.outputPixel(centroids[blocks[i].index])
+		}
+		prog.step()
+	}
+
+	return blocks
+}
+
+// progress reports completed blocks to a ProgressFunc. A nil progress
+// reports nothing.
+type progress struct {
+	fn          func(done, total int)
+	done, total int
+}
+
+// newProgress returns a progress reporting to fn, or nil if fn is nil
+func newProgress(fn func(done, total int), total int) *progress {
+	if fn == nil {
+		return nil
+	}
+	return &progress{fn: fn, total: total}
+}
+
+// step records one completed block
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+	p.done++
+	p.fn(p.done, p.total)
+}
+
+// blockDims returns the width and height of grid blocks
+func (opts *MosaicOptions) blockDims() image.Point {
+	dims := image.Pt(opts.BlockWidth, opts.BlockHeight)
+	if dims.X <= 0 {
+		dims.X = opts.BlockSize
+	}
+	if dims.Y <= 0 {
+		dims.Y = opts.BlockSize
+	}
+	return dims
+}
 
-			// Find nearest centroid
-			avgColor := findNearestCentroid(averagePixels(blockPixels), centroids)
+// blockStride returns the effective horizontal and vertical distances
+// between block origins
+func (opts *MosaicOptions) blockStride() image.Point {
+	stride := opts.blockDims()
+	if opts.BlockStride <= 0 || opts.variableBlocks() {
+		return stride
+	}
+	if opts.BlockStride <= stride.X {
+		stride.X = opts.BlockStride
+	}
+	if opts.BlockStride <= stride.Y {
+		stride.Y = opts.BlockStride
+	}
+	return stride
+}
 
-			// Fill block with average color
-			blockColor := color.RGBA{
-				R: uint8(avgColor.R * 255),
-				G: uint8(avgColor.G * 255),
-				B: uint8(avgColor.B * 255),
-				A: 255,
+// variableBlocks reports whether blocks are subdivided to varying sizes
+func (opts *MosaicOptions) variableBlocks() bool {
+	return opts.AdaptiveBlocks || opts.DensityMap != nil
+}
+
+// paintRegion paints the planned blocks of a single region into the output image
+func paintRegion(mosaic draw.Image, img image.Image, region *Region, blocks []mosaicBlock, opts *MosaicOptions) {
+	// Paint the background first so that blocks cover it where they are drawn
+	if opts.FillBackground != nil {
+		fillRegion(mosaic, region, *opts.FillBackground)
+	}
+
+	// Overlapping blocks are accumulated and blended once all are processed
+	if opts.blockStride() != opts.blockDims() {
+		blend := newBlendBuffer(region)
+		for _, block := range blocks {
+			if !block.keep {
+				blend.add(block.rect, opts.BlockShape, block.color)
 			}
+		}
+		blend.draw(mosaic)
+	} else {
+		for _, block := range blocks {
+			if !block.keep {
+				paintBlock(mosaic, block.rect, region.rect(), opts.BlockShape, outputColor(mosaic, block.color))
+			}
+		}
+	}
 
-			fillBlock(mosaic, x, y, opts.BlockSize, blockColor)
+	// Restore blocks kept at original resolution over the background and
+	// any overlapping blocks
+	for _, block := range blocks {
+		if block.keep {
+			rect := block.rect.Intersect(region.rect())
+			draw.Draw(mosaic, rect, img, rect.Min, draw.Src)
 		}
 	}
 
-	return mosaic
+	if opts.GridLines {
+		gridColor := opts.GridColor
+		if gridColor == nil {
+			gridColor = color.Black
+		}
+		rects := make([]image.Rectangle, len(blocks))
+		for i, block := range blocks {
+			rects[i] = block.rect
+		}
+		origin := image.Pt(region.X, region.Y)
+		if opts.gridOrigin != nil {
+			origin = *opts.gridOrigin
+		}
+		drawGrid(mosaic, region, origin, rects, max(1, opts.GridWidth), gridColor)
+	}
+}
+
+// blockRegion returns the block clipped to the region
+func blockRegion(region *Region, block image.Rectangle) *Region {
+	r := block.Intersect(region.rect())
+	return &Region{
+		X:      r.Min.X,
+		Y:      r.Min.Y,
+		Width:  r.Dx(),
+		Height: r.Dy(),
+		mask:   region.mask,
+	}
+}
+
+// rampColor picks the ramp color for a block, mapping the leftmost block of
+// the region to the first color and the rightmost block to the last
+func rampColor(ramp []color.RGBA, region *Region, block image.Rectangle) Pixel {
+	t := 0.0
+	if span := region.Width - block.Dx(); span > 0 {
+		t = float64(block.Min.X-region.X) / float64(span)
+	}
+	idx := int(math.Round(t * float64(len(ramp)-1)))
+	idx = max(0, min(idx, len(ramp)-1))
+
+	return rgbaToPixel(ramp[idx])
+}
+
+// blendBuffer accumulates the colors of overlapping blocks within a region
+type blendBuffer struct {
+	region *Region
+	sums   []Pixel
+	counts []int
+}
+
+// newBlendBuffer creates an empty blend buffer covering region
+func newBlendBuffer(region *Region) *blendBuffer {
+	n := region.Width * region.Height
+	return &blendBuffer{
+		region: region,
+		sums:   make([]Pixel, n),
+		counts: make([]int, n),
+	}
+}
+
+// add accumulates a block color over the block's pixels within the region
+// that are covered by the block shape
+func (b *blendBuffer) add(block image.Rectangle, shape BlockShape, c Pixel) {
+	r := block.Intersect(b.region.rect())
+	for by := r.Min.Y; by < r.Max.Y; by++ {
+		for bx := r.Min.X; bx < r.Max.X; bx++ {
+			if shape == BlockCircle && !inCircle(block, bx, by) {
+				continue
+			}
+			i := (by-b.region.Y)*b.region.Width + (bx - b.region.X)
+			b.sums[i].R += c.R
+			b.sums[i].G += c.G
+			b.sums[i].B += c.B
+			b.counts[i]++
+		}
+	}
+}
+
+// draw writes the averaged block colors into img
+func (b *blendBuffer) draw(img draw.Image) {
+	for i, n := range b.counts {
+		if n == 0 {
+			continue
+		}
+		sum := b.sums[i]
+		img.Set(b.region.X+i%b.region.Width, b.region.Y+i/b.region.Width, outputColor(img, Pixel{
+			R: sum.R / float64(n),
+			G: sum.G / float64(n),
+			B: sum.B / float64(n),
+		}))
+	}
+}
+
+// rect returns the region as a rectangle
+func (r *Region) rect() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+// Normalize clamps the region to bounds and returns the clamped copy. Only
+// the rectangle is clamped; other fields such as Invert, Angle and Shape
+// are kept and apply to the clamped rectangle. It returns an error if the region is
+// empty or lies entirely outside bounds.
+func (r *Region) Normalize(bounds image.Rectangle) (*Region, error) {
+	if r.Width <= 0 || r.Height <= 0 {
+		return nil, fmt.Errorf("mosaic: region %v is empty", r.rect())
+	}
+
+	clamped := r.rect().Intersect(bounds)
+	if clamped.Empty() {
+		return nil, fmt.Errorf("mosaic: region %v lies outside image bounds %v", r.rect(), bounds)
+	}
+
+	n := *r
+	n.X, n.Y, n.Width, n.Height = clamped.Min.X, clamped.Min.Y, clamped.Dx(), clamped.Dy()
+	return &n, nil
+}
+
+// withInvertedRegions returns options in which every inverted region is
+// replaced by the entire image and its rectangle is added to PreserveBoxes,
+// so it is neither clustered nor painted. Options without inverted regions
+// are returned unchanged.
+func (opts *MosaicOptions) withInvertedRegions() *MosaicOptions {
+	regions := opts.Regions
+	if len(regions) == 0 {
+		regions = []*Region{opts.Region}
+	}
+
+	inverted := false
+	for _, region := range regions {
+		if region != nil && region.Invert {
+			inverted = true
+		}
+	}
+	if !inverted {
+		return opts
+	}
+
+	o := *opts
+	o.PreserveBoxes = append([]image.Rectangle(nil), opts.PreserveBoxes...)
+	resolved := make([]*Region, len(regions))
+	for i, region := range regions {
+		if region != nil && region.Invert {
+			o.PreserveBoxes = append(o.PreserveBoxes, region.rect())
+			continue
+		}
+		resolved[i] = region
+	}
+
+	if len(opts.Regions) == 0 {
+		o.Region = resolved[0]
+	} else {
+		o.Regions = resolved
+	}
+	return &o
+}
+
+// regions returns the resolved regions to mosaic within bounds
+func (opts *MosaicOptions) regions(bounds image.Rectangle) []*Region {
+	if len(opts.RegionSpecs) > 0 {
+		regions := make([]*Region, len(opts.RegionSpecs))
+		for i, spec := range opts.RegionSpecs {
+			regions[i] = resolveRegion(bounds, spec.Region)
+		}
+		return regions
+	}
+	if len(opts.Regions) == 0 {
+		return []*Region{resolveRegion(bounds, opts.Region)}
+	}
+
+	regions := make([]*Region, len(opts.Regions))
+	for i, region := range opts.Regions {
+		regions[i] = resolveRegion(bounds, region)
+	}
+	return regions
+}
+
+// resolveRegion returns the region to process within bounds. A region
+// partially outside bounds is clamped, and a nil, empty or entirely outside
+// region resolves to the entire image. A rotated or elliptical region
+// resolves to its bounding box, masked to the region's shape.
+func resolveRegion(bounds image.Rectangle, region *Region) *Region {
+	if region != nil && (region.Angle != 0 || region.Shape == ShapeEllipse) && !region.Invert {
+		if normalized, err := region.boundingBox().Normalize(bounds); err == nil {
+			normalized.mask = region
+			return normalized
+		}
+	}
+	if region != nil {
+		if normalized, err := region.Normalize(bounds); err == nil {
+			return normalized
+		}
+	}
+	return &Region{
+		X:      bounds.Min.X,
+		Y:      bounds.Min.Y,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}
 }
 
 // imageToPixels converts a region of an image to a slice of Pixels
 func imageToPixels(img image.Image, region *Region) []Pixel {
-	pixels := make([]Pixel, 0, region.Width*region.Height)
+	return appendMaskedPixels(make([]Pixel, 0, region.Width*region.Height), img, region, nil, nil)
+}
+
+// readPixels converts the pixels of a region that are not excluded by the
+// options to a slice of Pixels, applying the configured color conversions
+func (opts *MosaicOptions) readPixels(img image.Image, region *Region) []Pixel {
+	return opts.appendPixels(make([]Pixel, 0, region.Width*region.Height), img, region)
+}
+
+// appendPixels is like readPixels but appends the pixels to dst
+func (opts *MosaicOptions) appendPixels(dst []Pixel, img image.Image, region *Region) []Pixel {
+	start := len(dst)
+	dst = appendMaskedPixels(dst, img, region, opts.PreserveBoxes, opts.transparentMask(img))
+	if opts.ColorTransform != nil || opts.Grayscale || opts.LinearizeGamma {
+		for i := start; i < len(dst); i++ {
+			dst[i] = opts.convertPixel(dst[i])
+		}
+	}
+	return dst
+}
 
+// convertPixel applies the configured color conversions to a pixel
+func (opts *MosaicOptions) convertPixel(p Pixel) Pixel {
+	if opts.ColorTransform != nil {
+		p = opts.ColorTransform(p)
+	}
+	if opts.Grayscale {
+		p = grayPixel(p)
+	}
+	if opts.LinearizeGamma {
+		p = linearizePixel(p)
+	}
+	return p
+}
+
+// appendMaskedPixels converts the pixels of a region that lie outside all
+// of the excluded rectangles to Pixels and appends them to pixels, skipping
+// pixels transparent reports (nil for none)
+func appendMaskedPixels(pixels []Pixel, img image.Image, region *Region, exclude []image.Rectangle, transparent func(x, y int) bool) []Pixel {
+	pixelAt := pixelReader(img)
 	for y := region.Y; y < region.Y+region.Height; y++ {
 		for x := region.X; x < region.X+region.Width; x++ {
-			r, g, b, _ := img.At(x, y).RGBA()
-			pixels = append(pixels, Pixel{
-				R: float64(r) / 65535,
-				G: float64(g) / 65535,
-				B: float64(b) / 65535,
-			})
+			if inAnyRect(x, y, exclude) || !region.contains(x, y) || (transparent != nil && transparent(x, y)) {
+				continue
+			}
+			pixels = append(pixels, pixelAt(x, y))
 		}
 	}
 
 	return pixels
 }
 
-// kmeans performs k-means clustering on pixels
-func kmeans(pixels []Pixel, k, maxIterations int, tolerance float64) []Pixel {
-	// Initialize random centroids
-	centroids := make([]Pixel, k)
-	for i := range centroids {
-		idx := rand.Intn(len(pixels))
-		centroids[i] = pixels[idx]
+// pixelReader returns a function reading the Pixel at (x, y), equal to
+// PixelFromColor(img.At(x, y)). RGBA and NRGBA images are read straight from
+// their Pix slices rather than through the color.Color interface.
+func pixelReader(img image.Image) func(x, y int) Pixel {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return func(x, y int) Pixel {
+			i := img.PixOffset(x, y)
+			s := img.Pix[i : i+3 : i+3]
+			return Pixel{
+				R: float64(uint32(s[0])*0x101) / 65535,
+				G: float64(uint32(s[1])*0x101) / 65535,
+				B: float64(uint32(s[2])*0x101) / 65535,
+			}
+		}
+	case *image.NRGBA:
+		return func(x, y int) Pixel {
+			i := img.PixOffset(x, y)
+			s := img.Pix[i : i+4 : i+4]
+			// Premultiply by alpha exactly as color.NRGBA.RGBA does
+			a := uint32(s[3]) * 0x101
+			return Pixel{
+				R: float64(uint32(s[0])*0x101*a/0xffff) / 65535,
+				G: float64(uint32(s[1])*0x101*a/0xffff) / 65535,
+				B: float64(uint32(s[2])*0x101*a/0xffff) / 65535,
+			}
+		}
+	default:
+		return func(x, y int) Pixel {
+			return PixelFromColor(img.At(x, y))
+		}
+	}
+}
+
+// PixelFromColor converts any color to a Pixel with channels in [0,1],
+// ignoring alpha
+func PixelFromColor(c color.Color) Pixel {
+	r, g, b, _ := c.RGBA()
+	return Pixel{
+		R: float64(r) / 65535,
+		G: float64(g) / 65535,
+		B: float64(b) / 65535,
+	}
+}
+
+// rgbaToPixel converts an 8-bit color to a Pixel
+func rgbaToPixel(c color.RGBA) Pixel {
+	return Pixel{
+		R: float64(c.R) / 255,
+		G: float64(c.G) / 255,
+		B: float64(c.B) / 255,
+	}
+}
+
+// inAnyRect reports whether the point (x, y) lies in any of the rectangles
+func inAnyRect(x, y int, rects []image.Rectangle) bool {
+	p := image.Pt(x, y)
+	for _, r := range rects {
+		if p.In(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// grayPixel converts a pixel to its luminance stored in all three channels
+func grayPixel(p Pixel) Pixel {
+	l := 0.299*p.R + 0.587*p.G + 0.114*p.B
+	return Pixel{R: l, G: l, B: l}
+}
+
+// pixelToRGBA64 converts a Pixel to an opaque 16-bit color
+func pixelToRGBA64(p Pixel) color.RGBA64 {
+	return color.RGBA64{
+		R: uint16(math.Round(clamp01(p.R) * 65535)),
+		G: uint16(math.Round(clamp01(p.G) * 65535)),
+		B: uint16(math.Round(clamp01(p.B) * 65535)),
+		A: 65535,
+	}
+}
+
+// clamp01 limits v to [0,1] so that color math overshooting the range
+// cannot wrap around when converted to an integer channel
+func clamp01(v float64) float64 {
+	return max(0, min(v, 1))
+}
+
+// ToRGBA converts the pixel to an opaque 8-bit color, clamping channels to
+// [0,1] and rounding to the nearest value
+func (p Pixel) ToRGBA() color.RGBA {
+	return color.RGBA{
+		R: uint8(math.Round(clamp01(p.R) * 255)),
+		G: uint8(math.Round(clamp01(p.G) * 255)),
+		B: uint8(math.Round(clamp01(p.B) * 255)),
+		A: 255,
+	}
+}
+
+// kmeans performs k-means clustering on pixels. It returns no centroids
+// when there are no pixels, and at most one centroid per pixel.
+func kmeans(pixels []Pixel, opts *MosaicOptions) ([]Pixel, *MosaicStats) {
+	if len(pixels) == 0 {
+		return nil, &MosaicStats{}
+	}
+	if kept := opts.withoutExcluded(pixels); len(kept) > 0 {
+		pixels = kept
+	}
+	pixels = samplePixels(pixels, opts.SampleRate)
+	rng := opts.random()
+	var centroids []Pixel
+	var stats *MosaicStats
+	if opts.UseHistogram {
+		bins, counts := histogramBins(pixels, histogramBits)
+		initial := initCentroids(bins, max(1, min(opts.K, len(bins))), opts.InitMethod, rng)
+		centroids, stats = refineWeightedCentroids(bins, counts, initial, opts)
+	} else {
+		initial := initCentroids(pixels, max(1, min(opts.K, len(pixels))), opts.InitMethod, rng)
+		switch {
+		case opts.ClusterAlgorithm == AlgoMiniBatch:
+			centroids, stats = miniBatchCentroids(pixels, initial, opts, rng)
+		case len(pixels) >= soaThreshold || opts.Workers > 1:
+			centroids, stats = refineCentroidsPlanes(opts.buffers.pixelPlanes(pixels), initial, opts)
+		default:
+			centroids, stats = refineCentroids(pixels, initial, opts)
+		}
+	}
+	if opts.MergeThreshold > 0 {
+		centroids, stats.ClusterSizes = mergeCentroids(centroids, stats.ClusterSizes, opts.MergeThreshold)
+	}
+	if opts.PaletteSnapGrid > 0 {
+		for i, c := range centroids {
+			centroids[i] = snapPixel(c, opts.PaletteSnapGrid)
+		}
+	}
+	if len(opts.GuidePalette) > 0 && opts.GuideStrength > 0 {
+		guides := opts.clusterColors(opts.GuidePalette)
+		for i, c := range centroids {
+			centroids[i] = guidePixel(c, guides, opts.GuideStrength)
+		}
+	}
+	if opts.SortByHue {
+		opts.sortByHue(centroids, stats.ClusterSizes)
+	}
+	return centroids, stats
+}
+
+// mergeCentroids repeatedly combines the two closest centroids while they
+// are nearer than threshold, weighting each by its cluster size
+func mergeCentroids(centroids []Pixel, sizes []int, threshold float64) ([]Pixel, []int) {
+	centroids = append([]Pixel(nil), centroids...)
+	sizes = append([]int(nil), sizes...)
+	for len(sizes) < len(centroids) {
+		sizes = append(sizes, 0)
+	}
+
+	for len(centroids) > 1 {
+		// Find the closest pair
+		a, b := -1, -1
+		minDist := threshold
+		for i := range centroids {
+			for j := i + 1; j < len(centroids); j++ {
+				if d := distance(centroids[i], centroids[j]); d < minDist {
+					a, b, minDist = i, j, d
+				}
+			}
+		}
+		if a < 0 {
+			break
+		}
+
+		// Weight by cluster size, treating two empty clusters equally
+		wa, wb := float64(sizes[a]), float64(sizes[b])
+		if wa+wb == 0 {
+			wa, wb = 1, 1
+		}
+		n := wa + wb
+		centroids[a] = Pixel{
+			R: (centroids[a].R*wa + centroids[b].R*wb) / n,
+			G: (centroids[a].G*wa + centroids[b].G*wb) / n,
+			B: (centroids[a].B*wa + centroids[b].B*wb) / n,
+		}
+		sizes[a] += sizes[b]
+		centroids = append(centroids[:b], centroids[b+1:]...)
+		sizes = append(sizes[:b], sizes[b+1:]...)
+	}
+
+	return centroids, sizes
+}
+
+// samplePixels returns an evenly strided subset of about rate*len(pixels)
+// pixels, taking the middle of each stride. A rate outside (0, 1) keeps every
+// pixel.
+func samplePixels(pixels []Pixel, rate float64) []Pixel {
+	if rate <= 0 || rate >= 1 {
+		return pixels
+	}
+
+	n := max(1, int(float64(len(pixels))*rate))
+	sampled := make([]Pixel, 0, n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, pixels[(2*i+1)*len(pixels)/(2*n)])
+	}
+	return sampled
+}
+
+// guidePixel returns the guide color nearest to p if it lies within
+// maxDist, and p itself otherwise
+func guidePixel(p Pixel, guides []Pixel, maxDist float64) Pixel {
+	nearest := findNearestCentroid(p, guides, distanceSquared)
+	if distance(p, nearest) <= maxDist {
+		return nearest
+	}
+	return p
+}
+
+// snapPixel rounds each channel of a pixel to the nearest of steps+1
+// evenly spaced levels
+func snapPixel(p Pixel, steps int) Pixel {
+	n := float64(steps)
+	return Pixel{
+		R: math.Round(p.R*n) / n,
+		G: math.Round(p.G*n) / n,
+		B: math.Round(p.B*n) / n,
 	}
+}
+
+// refineCentroids runs k-means iterations starting from the given centroids
+func refineCentroids(pixels []Pixel, centroids []Pixel, opts *MosaicOptions) ([]Pixel, *MosaicStats) {
+	k := len(centroids)
+	dist := opts.distanceFunc()
+	dists := opts.buffers.distances(len(pixels))
+	clusters := opts.buffers.clusterSlices(k)
+	stats := &MosaicStats{}
+	initialDiff := 0.0 // largest centroid move of the first iteration
 
-	for iteration := 0; iteration < maxIterations; iteration++ {
-		// Assign pixels to clusters
-		clusters := make([][]Pixel, k)
-		for _, p := range pixels {
-			nearest := findNearestCentroidIndex(p, centroids)
+	for iteration := 0; iteration < opts.Iterations; iteration++ {
+		// Assign pixels to clusters, reusing the cluster slices
+		for i := range clusters {
+			clusters[i] = clusters[i][:0]
+		}
+		nearestIndex := opts.nearestCentroidFunc(centroids, dist)
+		for j, p := range pixels {
+			nearest := nearestIndex(p)
 			clusters[nearest] = append(clusters[nearest], p)
+			dists[j] = dist(p, centroids[nearest])
 		}
 
 		// Update centroids
@@ -158,35 +1432,174 @@ func kmeans(pixels []Pixel, k, maxIterations int, tolerance float64) []Pixel {
 		for i := range centroids {
 			if len(clusters[i]) > 0 {
 				newCentroids[i] = averagePixels(clusters[i])
-				diff := distance(centroids[i], newCentroids[i])
-				if diff > maxDiff {
-					maxDiff = diff
-				}
 			} else {
+				// Reseed empty clusters with the pixel farthest from its centroid
 				newCentroids[i] = centroids[i]
+				if far := farthestPixelIndex(dists); far >= 0 {
+					newCentroids[i] = pixels[far]
+					dists[far] = 0
+				}
+			}
+
+			diff := distance(centroids[i], newCentroids[i])
+			if diff > maxDiff {
+				maxDiff = diff
 			}
 		}
 
 		centroids = newCentroids
 
+		stats.IterationsRun = iteration + 1
+		if opts.IterationFunc != nil {
+			opts.IterationFunc(iteration+1, centroids)
+		}
+		stats.FinalMaxDiff = maxDiff
+		if iteration == 0 {
+			initialDiff = maxDiff
+		}
+		stats.ClusterSizes = make([]int, k)
+		for i, cluster := range clusters {
+			stats.ClusterSizes[i] = len(cluster)
+		}
+
 		// Check for convergence
-		if maxDiff < tolerance {
+		if opts.converged(stats.IterationsRun, maxDiff, initialDiff) {
+			stats.Converged = true
 			break
 		}
 	}
 
+	return centroids, stats
+}
+
+// converged reports whether k-means can stop after iterations iterations,
+// the last of which moved centroids by at most maxDiff, given the first
+// iteration's move initialDiff
+func (opts *MosaicOptions) converged(iterations int, maxDiff, initialDiff float64) bool {
+	if iterations < opts.MinIterations {
+		return false
+	}
+	if opts.ConvergenceMode == ConvergenceRelative {
+		return maxDiff == 0 || maxDiff < opts.Tolerance*initialDiff
+	}
+	return maxDiff < opts.Tolerance
+}
+
+// farthestPixelIndex returns the index of the largest distance in dists,
+// or -1 when every distance is zero
+func farthestPixelIndex(dists []float64) int {
+	far := -1
+	maxDist := 0.0
+	for j, d := range dists {
+		if d > maxDist {
+			maxDist = d
+			far = j
+		}
+	}
+	return far
+}
+
+// random returns the source of random choices for clustering and jitter,
+// seeded by Seed when it is non-zero
+func (opts *MosaicOptions) random() *rand.Rand {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// initCentroids picks k pixels as initial centroids, at random, evenly
+// spaced or by k-means++ depending on method. Each pick prefers a color that
+// is not already a centroid, so that every distinct color gets a centroid
+// when k allows it.
+func initCentroids(pixels []Pixel, k int, method InitMethod, rng *rand.Rand) []Pixel {
+	centroids := make([]Pixel, k)
+	var nearest []float64 // squared distance of each pixel to its nearest centroid, for k-means++
+	if method == InitPlusPlus {
+		nearest = make([]float64, len(pixels))
+		for j := range nearest {
+			nearest[j] = math.Inf(1)
+		}
+	}
+	exhausted := false
+	for i := range centroids {
+		var idx int
+		switch {
+		case method == InitFixedSampling:
+			idx = int((float64(i) + 0.5) * float64(len(pixels)) / float64(k))
+		case method == InitPlusPlus && i > 0:
+			idx = weightedIndex(nearest, rng)
+		default:
+			idx = rng.Intn(len(pixels))
+		}
+		if !exhausted {
+			exhausted = true
+			for n := 0; n < len(pixels); n++ {
+				j := (idx + n) % len(pixels)
+				if !containsPixel(centroids[:i], pixels[j]) {
+					idx = j
+					exhausted = false
+					break
+				}
+			}
+		}
+		centroids[i] = pixels[idx]
+		for j := range nearest {
+			nearest[j] = min(nearest[j], distanceSquared(pixels[j], centroids[i]))
+		}
+	}
 	return centroids
 }
 
-// findNearestCentroidIndex finds the index of the nearest centroid to a pixel
-func findNearestCentroidIndex(p Pixel, centroids []Pixel) int {
+// weightedIndex picks an index with probability proportional to its weight,
+// or uniformly when all weights are zero
+func weightedIndex(weights []float64, rng *rand.Rand) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return rng.Intn(len(weights))
+	}
+
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	// Rounding can leave r just above the last weight
+	for i := len(weights) - 1; i > 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// containsPixel reports whether pixels contains p
+func containsPixel(pixels []Pixel, p Pixel) bool {
+	for _, q := range pixels {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// findNearestCentroidIndex finds the index of the nearest centroid to a
+// pixel. Equidistant centroids are broken by the smaller color (see
+// pixelLess), so the choice does not depend on the centroids' order.
+func findNearestCentroidIndex(p Pixel, centroids []Pixel, dist distanceFunc) int {
 	minDist := math.MaxFloat64
 	nearest := 0
 
 	for i, c := range centroids {
-		dist := distance(p, c)
-		if dist < minDist {
-			minDist = dist
+		d := dist(p, c)
+		if d < minDist || (d == minDist && pixelLess(c, centroids[nearest])) {
+			minDist = d
 			nearest = i
 		}
 	}
@@ -194,17 +1607,57 @@ func findNearestCentroidIndex(p Pixel, centroids []Pixel) int {
 	return nearest
 }
 
+// pixelLess orders pixels lexicographically by R, then G, then B
+func pixelLess(a, b Pixel) bool {
+	if a.R != b.R {
+		return a.R < b.R
+	}
+	if a.G != b.G {
+		return a.G < b.G
+	}
+	return a.B < b.B
+}
+
 // findNearestCentroid finds the nearest centroid to a pixel
-func findNearestCentroid(p Pixel, centroids []Pixel) Pixel {
-	return centroids[findNearestCentroidIndex(p, centroids)]
+func findNearestCentroid(p Pixel, centroids []Pixel, dist distanceFunc) Pixel {
+	return centroids[findNearestCentroidIndex(p, centroids, dist)]
+}
+
+// distanceFunc measures the squared distance between two pixels. It is only
+// used to compare distances, where the square root would be wasted work.
+type distanceFunc func(p1, p2 Pixel) float64
+
+// distanceFunc returns the squared color distance configured by DistanceWeights
+func (opts *MosaicOptions) distanceFunc() distanceFunc {
+	w := opts.DistanceWeights
+	if w == [3]float64{} || w == [3]float64{1, 1, 1} {
+		return distanceSquared
+	}
+	return weightedDistanceSquared(w)
+}
+
+// weightedDistanceSquared returns a squared Euclidean distance with
+// per-channel weights
+func weightedDistanceSquared(w [3]float64) distanceFunc {
+	return func(p1, p2 Pixel) float64 {
+		dr := p1.R - p2.R
+		dg := p1.G - p2.G
+		db := p1.B - p2.B
+		return w[0]*dr*dr + w[1]*dg*dg + w[2]*db*db
+	}
 }
 
 // distance calculates Euclidean distance between two pixels
 func distance(p1, p2 Pixel) float64 {
+	return math.Sqrt(distanceSquared(p1, p2))
+}
+
+// distanceSquared calculates the squared Euclidean distance between two pixels
+func distanceSquared(p1, p2 Pixel) float64 {
 	dr := p1.R - p2.R
 	dg := p1.G - p2.G
 	db := p1.B - p2.B
-	return math.Sqrt(dr*dr + dg*dg + db*db)
+	return dr*dr + dg*dg + db*db
 }
 
 // averagePixels calculates the average color of a slice of pixels
@@ -228,12 +1681,66 @@ func averagePixels(pixels []Pixel) Pixel {
 	}
 }
 
+// paintBlock fills the shape of a block with a single color, writing only
+// pixels within clip (usually the region) so that blocks straddling its edge
+// do not bleed past it
+func paintBlock(img draw.Image, block, clip image.Rectangle, shape BlockShape, c color.Color) {
+	if shape == BlockCircle {
+		fillCircleBlock(img, block, clip, c)
+	} else {
+		fillBlock(img, block.Intersect(clip), c)
+	}
+}
+
 // fillBlock fills a block in the image with a single color
-func fillBlock(img *image.RGBA, x, y, size int, c color.Color) {
-	bounds := img.Bounds()
-	for by := 0; by < size && y+by < bounds.Max.Y; by++ {
-		for bx := 0; bx < size && x+bx < bounds.Max.X; bx++ {
-			img.Set(x+bx, y+by, c)
+func fillBlock(img draw.Image, block image.Rectangle, c color.Color) {
+	r := block.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, c)
 		}
 	}
 }
+
+// fillCircleBlock fills the part within clip of the circle inscribed in a
+// block with a single color
+func fillCircleBlock(img draw.Image, block, clip image.Rectangle, c color.Color) {
+	r := block.Intersect(clip).Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if inCircle(block, x, y) {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+// inCircle reports whether the pixel (px, py) lies within the circle
+// inscribed in the block
+func inCircle(block image.Rectangle, px, py int) bool {
+	r := float64(min(block.Dx(), block.Dy())) / 2
+	dx := float64(px) + 0.5 - float64(block.Min.X+block.Max.X)/2
+	dy := float64(py) + 0.5 - float64(block.Min.Y+block.Max.Y)/2
+	return dx*dx+dy*dy <= r*r
+}
+
+// drawGrid draws lines along the top and left edges of blocks that border
+// another block, clipped to the region. Blocks starting at the grid's origin
+// have no neighbor above or to the left.
+func drawGrid(img draw.Image, region *Region, origin image.Point, blocks []image.Rectangle, width int, c color.Color) {
+	for _, block := range blocks {
+		if block.Min.X > origin.X {
+			line := image.Rect(block.Min.X, block.Min.Y, block.Min.X+width, block.Max.Y)
+			fillBlock(img, line.Intersect(region.rect()), c)
+		}
+		if block.Min.Y > origin.Y {
+			line := image.Rect(block.Min.X, block.Min.Y, block.Max.X, block.Min.Y+width)
+			fillBlock(img, line.Intersect(region.rect()), c)
+		}
+	}
+}
+
+// fillRegion fills a region of the image with a single color
+func fillRegion(img draw.Image, region *Region, c color.Color) {
+	draw.Draw(img, region.rect(), image.NewUniform(c), image.Point{}, draw.Src)
+}
@@ -1,8 +1,14 @@
 package mosaic
 
 import (
+	"bytes"
+	_ "embed"
+	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
+	"math/rand"
+	"sort"
 	"testing"
 )
 
@@ -19,6 +25,13 @@ func TestDefaultOptions(t *testing.T) {
 		{"Iterations value", opts.Iterations, 50},
 		{"Tolerance value", opts.Tolerance, 0.001},
 		{"Region value", opts.Region, (*Region)(nil)},
+		{"DistanceWeights value", opts.DistanceWeights, [3]float64{1, 1, 1}},
+		{"KeyTolerance value", opts.KeyTolerance, 0.05},
+		{"MinBlockSize value", opts.MinBlockSize, 2},
+		{"VarianceThreshold value", opts.VarianceThreshold, 0.01},
+		{"EdgeThreshold value", opts.EdgeThreshold, 0.5},
+		{"BatchSize value", opts.BatchSize, 1024},
+		{"FrameDelay value", opts.FrameDelay, 50},
 	}
 
 	for _, tt := range tests {
@@ -71,17 +84,597 @@ func TestCreateMosaic(t *testing.T) {
 			bounds.Dx(), bounds.Dy(), width, height)
 	}
 
-	// Check colors in the mosaic region
-	centerX := region.X + region.Width/2
+	// Check colors in the mosaic region. The center block straddles the
+	// red/blue boundary evenly, so probe the outermost blocks instead.
 	centerY := region.Y + region.Height/2
-	color := result.At(centerX, centerY)
-	r, _, _, _ := color.RGBA()
+	r, _, _, _ := result.At(region.X, centerY).RGBA()
+	_, _, b, _ := result.At(region.X+region.Width-1, centerY).RGBA()
 
-	if r == 0 {
+	if r == 0 || b == 0 {
 		t.Error("Expected color separation not found in mosaic region")
 	}
 }
 
+func TestCreateMosaicMultipleRegions(t *testing.T) {
+	// Create test image with a repeating four-color pattern
+	width, height := 60, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	colors := []color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{B: 255, A: 255},
+		{R: 255, G: 255, A: 255},
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, colors[(y%2)*2+x%2])
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 4
+	opts.Regions = []*Region{
+		{X: 0, Y: 0, Width: 20, Height: 20},
+		{X: 40, Y: 0, Width: 20, Height: 20},
+	}
+
+	result := CreateMosaic(img, opts)
+
+	// Both regions are painted with uniform blocks
+	for _, region := range opts.Regions {
+		first := result.At(region.X, region.Y)
+		if got := result.At(region.X+1, region.Y); got != first {
+			t.Errorf("region at x=%d not mosaicked: %v != %v", region.X, got, first)
+		}
+	}
+
+	// The area between the regions is untouched
+	for x := 20; x < 40; x++ {
+		if got, want := result.At(x, 5), img.At(x, 5); got != want {
+			t.Errorf("pixel at x=%d = %v, want original %v", x, got, want)
+		}
+	}
+}
+
+func TestCreateMosaicPreserveBoxes(t *testing.T) {
+	// Create test image with alternating black and white columns
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x%2 == 0 {
+				img.Set(x, y, color.RGBA{A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+
+	box := image.Rect(10, 10, 20, 20)
+	opts := DefaultOptions()
+	opts.K = 1
+	opts.PreserveBoxes = []image.Rectangle{box}
+
+	result := CreateMosaic(img, opts)
+
+	// Pixels inside the box are unchanged
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			if got, want := result.At(x, y), img.At(x, y); got != want {
+				t.Fatalf("preserved pixel (%d,%d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	// The rest of the region is mosaicked into a uniform gray
+	if got, want := result.At(30, 30), result.At(31, 30); got != want {
+		t.Errorf("pixel outside box not mosaicked: %v != %v", got, want)
+	}
+}
+
+func TestCreateMosaicGridLines(t *testing.T) {
+	// Create solid white test image
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, white)
+		}
+	}
+
+	gridColor := color.RGBA{R: 255, A: 255}
+	opts := DefaultOptions()
+	opts.K = 1
+	opts.Region = &Region{X: 5, Y: 5, Width: 30, Height: 30}
+	opts.GridLines = true
+	opts.GridColor = gridColor
+
+	result := CreateMosaic(img, opts)
+
+	tests := []struct {
+		name     string
+		x, y     int
+		expected color.RGBA
+	}{
+		{"Vertical block boundary", 15, 20, gridColor},
+		{"Horizontal block boundary", 20, 25, gridColor},
+		{"Block interior", 20, 20, white},
+		{"Region edge", 5, 20, white},
+		{"Outside region", 15, 2, white},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := result.At(tt.x, tt.y); got != tt.expected {
+				t.Errorf("pixel (%d,%d) = %v, want %v", tt.x, tt.y, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreateMosaicGrayscale(t *testing.T) {
+	// Create colorful test image
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(255 - y*6), B: uint8((x + y) * 3), A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 4
+	opts.Grayscale = true
+
+	result := CreateMosaic(img, opts)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := result.At(x, y).(color.RGBA)
+			if absDiff(c.R, c.G) > 1 || absDiff(c.G, c.B) > 1 {
+				t.Fatalf("pixel (%d,%d) = %v, want gray", x, y, c)
+			}
+		}
+	}
+}
+
+func TestCreateMosaicPalette(t *testing.T) {
+	// Create a rainbow image with hue varying across the width
+	width, height := 60, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, hueColor(float64(x)/float64(width)))
+		}
+	}
+
+	navy := color.RGBA{R: 0, G: 0, B: 128, A: 255}
+	gold := color.RGBA{R: 255, G: 200, B: 0, A: 255}
+	opts := DefaultOptions()
+	opts.Palette = []color.RGBA{navy, gold}
+
+	result := CreateMosaic(img, opts)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got := result.At(x, y); got != navy && got != gold {
+				t.Fatalf("pixel (%d,%d) = %v, want %v or %v", x, y, got, navy, gold)
+			}
+		}
+	}
+}
+
+// hueColor returns the fully saturated color of hue h in [0, 1)
+func hueColor(h float64) color.RGBA {
+	sector := int(h * 6)
+	f := uint8((h*6 - float64(sector)) * 255)
+	switch sector {
+	case 0:
+		return color.RGBA{R: 255, G: f, A: 255}
+	case 1:
+		return color.RGBA{R: 255 - f, G: 255, A: 255}
+	case 2:
+		return color.RGBA{G: 255, B: f, A: 255}
+	case 3:
+		return color.RGBA{G: 255 - f, B: 255, A: 255}
+	case 4:
+		return color.RGBA{R: f, B: 255, A: 255}
+	default:
+		return color.RGBA{R: 255, B: 255 - f, A: 255}
+	}
+}
+
+func TestCreateMosaicColorTransform(t *testing.T) {
+	// Create test image with red on the left and green on the right
+	width, height := 20, 10
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 10 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{G: 255, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.ColorTransform = func(p Pixel) Pixel {
+		return Pixel{R: p.B, G: p.G, B: p.R}
+	}
+
+	// Red becomes blue while green is unchanged
+	blue := color.RGBA{B: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+
+	result := CreateMosaic(img, opts)
+	if got := result.At(5, 5); got != blue {
+		t.Errorf("left block = %v, want %v", got, blue)
+	}
+	if got := result.At(15, 5); got != green {
+		t.Errorf("right block = %v, want %v", got, green)
+	}
+
+	palette := ExtractPalette(img, opts)
+	for _, c := range palette {
+		if c != blue && c != green {
+			t.Errorf("palette color %v, want only %v and %v", c, blue, green)
+		}
+	}
+}
+
+// absDiff returns the absolute difference of two channel values
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+func TestCreateMosaicInvertRegion(t *testing.T) {
+	// Create test image with a noisy gradient so that quantization is visible
+	width, height := 60, 60
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8((x * y) % 256), A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 4
+	opts.Region = &Region{X: 20, Y: 20, Width: 20, Height: 20, Invert: true}
+
+	result := CreateMosaic(img, opts)
+
+	// The rectangle keeps the original pixels
+	for y := 20; y < 40; y++ {
+		for x := 20; x < 40; x++ {
+			if got, want := result.At(x, y), img.At(x, y); got != want {
+				t.Fatalf("inside pixel (%d,%d) = %v, want original %v", x, y, got, want)
+			}
+		}
+	}
+
+	// The border is quantized to at most K colors
+	colors := make(map[color.Color]bool)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 20 || x >= 40 || y < 20 || y >= 40 {
+				colors[result.At(x, y)] = true
+			}
+		}
+	}
+	if len(colors) > opts.K {
+		t.Errorf("border uses %d colors, want at most %d", len(colors), opts.K)
+	}
+	if got, want := result.At(1, 1), img.At(1, 1); got == want {
+		t.Errorf("border pixel (1,1) = %v, want it mosaicked", got)
+	}
+}
+
+func TestCreateMosaicBlockStride(t *testing.T) {
+	// Create test image split into red (x < 12) and blue
+	width, height := 20, 10
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 12 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.BlockSize = 10
+	opts.BlockStride = opts.BlockSize / 2
+
+	result := CreateMosaic(img, opts)
+
+	tests := []struct {
+		name     string
+		x        int
+		expected color.RGBA
+	}{
+		// Covered only by blocks that are mostly red
+		{"Single block color", 2, color.RGBA{R: 255, A: 255}},
+		// Covered by the mostly red block at x=5 and the mostly blue block at x=10
+		{"Blended overlap", 12, color.RGBA{R: 128, B: 128, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := result.At(tt.x, height/2).(color.RGBA)
+			if got != tt.expected {
+				t.Errorf("pixel at x=%d = %v, want %v", tt.x, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreateMosaicFillBackground(t *testing.T) {
+	// Create solid green test image
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	green := color.RGBA{G: 255, A: 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, green)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 1
+	opts.Region = &Region{X: 10, Y: 10, Width: 20, Height: 20}
+	opts.FillBackground = &color.RGBA{A: 0}
+
+	result := CreateMosaic(img, opts)
+
+	// Square blocks cover the whole region, so no background shows through
+	if got := result.At(15, 15); got != green {
+		t.Errorf("pixel inside region = %v, want %v", got, green)
+	}
+
+	// The background never spreads outside the region
+	if got := result.At(5, 5); got != green {
+		t.Errorf("pixel outside region = %v, want %v", got, green)
+	}
+}
+
+func TestCreateMosaicBlockWidthHeight(t *testing.T) {
+	// Create a checkerboard of 20x5 cells
+	width, height := 100, 100
+	black := color.RGBA{A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x/20+y/5)%2 == 0 {
+				img.Set(x, y, black)
+			} else {
+				img.Set(x, y, white)
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.BlockWidth = 20
+	opts.BlockHeight = 5
+
+	result := CreateMosaic(img, opts)
+
+	// Blocks line up with the cells, so every cell keeps its color
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got, want := result.At(x, y), img.At(x, y); got != want {
+				t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestCreateMosaicPositionRamp(t *testing.T) {
+	// Create solid gray test image
+	width, height := 100, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 128, G: 128, B: 128, A: 255})
+		}
+	}
+
+	ramp := []color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{B: 255, A: 255},
+	}
+
+	opts := DefaultOptions()
+	opts.PositionRamp = ramp
+
+	result := CreateMosaic(img, opts)
+
+	tests := []struct {
+		name     string
+		x        int
+		expected color.RGBA
+	}{
+		{"Leftmost block", 0, ramp[0]},
+		{"Middle block", width / 2, ramp[1]},
+		{"Rightmost block", width - 1, ramp[2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := result.At(tt.x, height/2).(color.RGBA)
+			if got != tt.expected {
+				t.Errorf("pixel at x=%d = %v, want %v", tt.x, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPositionRampFollowsVariance(t *testing.T) {
+	// A gray image with a checkerboard in its top-left block
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+			if x < 10 && y < 10 && (x+y)%2 == 0 {
+				c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.PositionRamp = []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}, {A: 255}}
+
+	// Without setting AdaptiveBlocks, the busy block is subdivided so its
+	// quadrants take different ramp colors
+	result := CreateMosaicRGBA(img, opts)
+	if left, right := result.RGBAAt(0, 0), result.RGBAAt(9, 0); left == right {
+		t.Errorf("busy block painted in a single color %v, want it subdivided", left)
+	}
+
+	// The flat block below keeps its full size
+	if left, right := result.RGBAAt(0, 15), result.RGBAAt(9, 15); left != right {
+		t.Errorf("flat block painted %v and %v, want a single color", left, right)
+	}
+}
+
+func TestCreateMosaicCircleBlocks(t *testing.T) {
+	// Create test image with alternating black and white columns
+	width, height := 20, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	black := color.RGBA{A: 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x%2 == 0 {
+				img.Set(x, y, black)
+			} else {
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 1
+	opts.BlockShape = BlockCircle
+
+	result := CreateMosaic(img, opts)
+
+	// The corner of a block lies outside its circle
+	if got := result.At(0, 0); got != black {
+		t.Errorf("corner pixel = %v, want original %v", got, black)
+	}
+
+	// The center of a block gets the clustered gray
+	if r, _, _, _ := result.At(4, 5).RGBA(); r == 0 || r == 0xffff {
+		t.Errorf("center pixel = %v, want clustered gray", result.At(4, 5))
+	}
+
+	// With a background color the corner is painted instead of kept
+	background := color.RGBA{R: 255, A: 255}
+	opts.FillBackground = &background
+	result = CreateMosaic(img, opts)
+
+	if got := result.At(0, 0); got != background {
+		t.Errorf("corner pixel with background = %v, want %v", got, background)
+	}
+}
+
+func TestCreateMosaicWithStats(t *testing.T) {
+	// Create trivially separable red/blue test image
+	width, height := 40, 40
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	t.Run("Converges early", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.K = 2
+
+		_, stats := CreateMosaicWithStats(img, opts)
+
+		if !stats.Converged {
+			t.Error("Converged = false, want true")
+		}
+		if stats.IterationsRun >= opts.Iterations {
+			t.Errorf("IterationsRun = %d, want fewer than %d", stats.IterationsRun, opts.Iterations)
+		}
+		if len(stats.ClusterSizes) != opts.K {
+			t.Fatalf("len(ClusterSizes) = %d, want %d", len(stats.ClusterSizes), opts.K)
+		}
+		for i, n := range stats.ClusterSizes {
+			if n != width*height/2 {
+				t.Errorf("ClusterSizes[%d] = %d, want %d", i, n, width*height/2)
+			}
+		}
+	})
+
+	t.Run("Zero tolerance runs all iterations", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.K = 2
+		opts.Iterations = 7
+		opts.Tolerance = 0
+
+		_, stats := CreateMosaicWithStats(img, opts)
+
+		if stats.Converged {
+			t.Error("Converged = true, want false")
+		}
+		if stats.IterationsRun != opts.Iterations {
+			t.Errorf("IterationsRun = %d, want %d", stats.IterationsRun, opts.Iterations)
+		}
+	})
+}
+
+func TestCreateMosaicProgressFunc(t *testing.T) {
+	// Create test image that is not a multiple of the block size
+	width, height := 45, 25
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 5), G: uint8(y * 10), A: 255})
+		}
+	}
+
+	calls := 0
+	lastDone, lastTotal := 0, 0
+	opts := DefaultOptions()
+	opts.ProgressFunc = func(done, total int) {
+		calls++
+		if done != lastDone+1 {
+			t.Errorf("done = %d after %d, want consecutive counts", done, lastDone)
+		}
+		lastDone, lastTotal = done, total
+	}
+
+	CreateMosaic(img, opts)
+
+	expectedTotal := 5 * 3 // 45x25 pixels in 10x10 blocks
+	if lastTotal != expectedTotal {
+		t.Errorf("total = %d, want %d", lastTotal, expectedTotal)
+	}
+	if lastDone != lastTotal || calls != lastTotal {
+		t.Errorf("final done = %d after %d calls, want %d", lastDone, calls, lastTotal)
+	}
+}
+
 func TestPixelOperations(t *testing.T) {
 	tests := []struct {
 		name string
@@ -90,6 +683,7 @@ func TestPixelOperations(t *testing.T) {
 		{"Distance calculation", testDistance},
 		{"Average pixels", testAveragePixels},
 		{"Find nearest centroid", testFindNearestCentroid},
+		{"Weighted distance", testWeightedDistance},
 	}
 
 	for _, tt := range tests {
@@ -129,13 +723,270 @@ func testFindNearestCentroid(t *testing.T) {
 		{R: 0.0, G: 0.0, B: 1.0}, // Blue
 	}
 
-	testPixel := Pixel{R: 0.9, G: 0.0, B: 0.1} // Color close to red
+	testPixel := Pixel{R: 0.9, G: 0.0, B: 0.1} // Color close to red
+
+	got := findNearestCentroid(testPixel, centroids, distance)
+	expected := centroids[0] // Should be closest to first centroid (red)
+
+	if got != expected {
+		t.Errorf("findNearestCentroid() = %v, want %v", got, expected)
+	}
+}
+
+func TestKmeansReseedsEmptyClusters(t *testing.T) {
+	// Create a white test image with a small red square
+	width, height := 20, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x >= 8 && x < 11 && y >= 8 && y < 11 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+
+	pixels := imageToPixels(img, &Region{X: 0, Y: 0, Width: width, Height: height})
+
+	// Start with both centroids clumped on the dominant white
+	white := Pixel{R: 1.0, G: 1.0, B: 1.0}
+	centroids, _ := refineCentroids(pixels, []Pixel{white, white}, DefaultOptions())
+
+	red := Pixel{R: 1.0, G: 0.0, B: 0.0}
+	if !containsPixel(centroids, white) || !containsPixel(centroids, red) {
+		t.Errorf("refineCentroids() = %v, want both %v and %v", centroids, white, red)
+	}
+}
+
+func testWeightedDistance(t *testing.T) {
+	centroids := []Pixel{
+		{R: 0.0, G: 0.2, B: 0.0}, // Differs from the pixel in red
+		{R: 0.6, G: 0.6, B: 0.0}, // Differs from the pixel in green
+	}
+
+	testPixel := Pixel{R: 0.6, G: 0.2, B: 0.0}
+
+	if got := findNearestCentroidIndex(testPixel, centroids, distance); got != 1 {
+		t.Errorf("findNearestCentroidIndex() unweighted = %d, want 1", got)
+	}
+
+	heavyGreen := weightedDistanceSquared([3]float64{1, 4, 1})
+	if got := findNearestCentroidIndex(testPixel, centroids, heavyGreen); got != 0 {
+		t.Errorf("findNearestCentroidIndex() with heavy green weight = %d, want 0", got)
+	}
+}
+
+func TestDistanceSquaredNearestCentroid(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomPixel := func() Pixel {
+		return Pixel{R: rng.Float64(), G: rng.Float64(), B: rng.Float64()}
+	}
+
+	centroids := make([]Pixel, 16)
+	for i := range centroids {
+		centroids[i] = randomPixel()
+	}
+
+	for i := 0; i < 1000; i++ {
+		p := randomPixel()
+		euclidean := findNearestCentroidIndex(p, centroids, distance)
+		squared := findNearestCentroidIndex(p, centroids, distanceSquared)
+		if euclidean != squared {
+			t.Fatalf("nearest centroid of %v: distanceSquared = %d, distance = %d", p, squared, euclidean)
+		}
+	}
+}
+
+func BenchmarkFindNearestCentroidIndex(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	pixels := make([]Pixel, 1024)
+	for i := range pixels {
+		pixels[i] = Pixel{R: rng.Float64(), G: rng.Float64(), B: rng.Float64()}
+	}
+	centroids := pixels[:16]
+
+	for _, bm := range []struct {
+		name string
+		dist distanceFunc
+	}{
+		{"Distance", distance},
+		{"DistanceSquared", distanceSquared},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				findNearestCentroidIndex(pixels[i%len(pixels)], centroids, bm.dist)
+			}
+		})
+	}
+}
+
+func TestKmeansSampleRate(t *testing.T) {
+	// Create a horizontal black-to-white gradient
+	width, height := 200, 50
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(x * 255 / (width - 1))
+			img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	pixels := imageToPixels(img, &Region{X: 0, Y: 0, Width: width, Height: height})
+
+	opts := DefaultOptions()
+	opts.K = 2
+
+	full, _ := kmeans(pixels, opts)
+	opts.SampleRate = 0.25
+	sampled, _ := kmeans(pixels, opts)
+
+	// Compare the centroids ordered from dark to light
+	sort.Slice(full, func(i, j int) bool { return full[i].R < full[j].R })
+	sort.Slice(sampled, func(i, j int) bool { return sampled[i].R < sampled[j].R })
+
+	for i := range full {
+		if d := distance(full[i], sampled[i]); d > 0.05 {
+			t.Errorf("centroid %d: sampled %v differs from full %v by %v", i, sampled[i], full[i], d)
+		}
+	}
+}
+
+func TestSamplePixels(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		rate  float64
+		want  int
+	}{
+		{"quarter", 100, 0.25, 25},
+		{"fewer than one pixel", 3, 0.1, 1},
+		{"single pixel", 1, 0.01, 1},
+		{"rate of 1", 10, 1, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pixels := make([]Pixel, tt.count)
+			for i := range pixels {
+				pixels[i] = Pixel{R: float64(i) / float64(tt.count)}
+			}
+			if got := samplePixels(pixels, tt.rate); len(got) != tt.want {
+				t.Errorf("samplePixels() returned %d pixels, want %d", len(got), tt.want)
+			}
+		})
+	}
+
+	// A tiny region with a low rate still clusters
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	opts := DefaultOptions()
+	opts.SampleRate = 0.1
+	if result := CreateMosaic(img, opts); result.Bounds() != img.Bounds() {
+		t.Errorf("CreateMosaic() bounds = %v, want %v", result.Bounds(), img.Bounds())
+	}
+}
+
+func BenchmarkKmeansSampleRate(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	pixels := make([]Pixel, 512*512)
+	for i := range pixels {
+		v := float64(i%512) / 511
+		pixels[i] = Pixel{R: v, G: v * rng.Float64(), B: 1 - v}
+	}
+
+	for _, rate := range []float64{1, 0.1} {
+		b.Run(fmt.Sprintf("Rate%v", rate), func(b *testing.B) {
+			opts := DefaultOptions()
+			opts.SampleRate = rate
+			for i := 0; i < b.N; i++ {
+				kmeans(pixels, opts)
+			}
+		})
+	}
+}
+
+func TestCreateMosaicDegenerateInputs(t *testing.T) {
+	// newImage creates a width x height image of a single color
+	newImage := func(width, height int) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+			}
+		}
+		return img
+	}
+
+	tests := []struct {
+		name   string
+		img    *image.RGBA
+		modify func(*MosaicOptions)
+	}{
+		{"empty image", newImage(0, 0), func(*MosaicOptions) {}},
+		{"zero-width region", newImage(20, 20), func(o *MosaicOptions) {
+			o.Region = &Region{X: 5, Y: 5, Width: 0, Height: 10}
+		}},
+		{"K above pixel count", newImage(2, 2), func(o *MosaicOptions) { o.K = 10 }},
+		{"every pixel preserved", newImage(20, 20), func(o *MosaicOptions) {
+			o.PreserveBoxes = []image.Rectangle{image.Rect(0, 0, 20, 20)}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(opts)
+
+			result, stats := CreateMosaicWithStats(tt.img, opts)
+
+			if result.Bounds() != tt.img.Bounds() {
+				t.Errorf("Bounds() = %v, want %v", result.Bounds(), tt.img.Bounds())
+			}
+			if len(stats.ClusterSizes) > max(1, tt.img.Bounds().Dx()*tt.img.Bounds().Dy()) {
+				t.Errorf("got %d clusters for %v pixels", len(stats.ClusterSizes), tt.img.Bounds().Size())
+			}
+
+			// A single-color image is unchanged by mosaicking
+			if !tt.img.Bounds().Empty() {
+				if got, want := result.At(0, 0), tt.img.At(0, 0); got != want {
+					t.Errorf("pixel (0,0) = %v, want %v", got, want)
+				}
+			}
+
+			if palette := ExtractPalette(tt.img, opts); tt.img.Bounds().Empty() && len(palette) != 0 {
+				t.Errorf("ExtractPalette() of an empty image = %v, want none", palette)
+			}
+		})
+	}
+}
+
+func TestRegionNormalize(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 50)
 
-	got := findNearestCentroid(testPixel, centroids)
-	expected := centroids[0] // Should be closest to first centroid (red)
+	tests := []struct {
+		name    string
+		region  Region
+		want    *Region
+		wantErr bool
+	}{
+		{"inside", Region{X: 10, Y: 10, Width: 20, Height: 20}, &Region{X: 10, Y: 10, Width: 20, Height: 20}, false},
+		{"partially outside", Region{X: 90, Y: -10, Width: 20, Height: 30}, &Region{X: 90, Y: 0, Width: 10, Height: 20}, false},
+		{"entirely outside", Region{X: 200, Y: 10, Width: 20, Height: 20}, nil, true},
+		{"empty", Region{X: 10, Y: 10, Width: 0, Height: 20}, nil, true},
+		{"inverted", Region{X: 90, Y: 10, Width: 20, Height: 20, Invert: true}, &Region{X: 90, Y: 10, Width: 10, Height: 20, Invert: true}, false},
+		{"rotated", Region{X: 90, Y: 10, Width: 20, Height: 20, Angle: 0.5}, &Region{X: 90, Y: 10, Width: 10, Height: 20, Angle: 0.5}, false},
+		{"rotated ellipse", Region{X: 10, Y: 10, Width: 20, Height: 20, Angle: 0.5, Shape: ShapeEllipse}, &Region{X: 10, Y: 10, Width: 20, Height: 20, Angle: 0.5, Shape: ShapeEllipse}, false},
+	}
 
-	if got != expected {
-		t.Errorf("findNearestCentroid() = %v, want %v", got, expected)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.region.Normalize(bounds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("Normalize() = %+v, want %+v", *got, *tt.want)
+			}
+		})
 	}
 }
 
@@ -175,3 +1026,619 @@ func TestImageToPixels(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateMosaicColorsUsed(t *testing.T) {
+	// Create test image with three colors in wide stripes
+	width, height := 30, 10
+	stripes := []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, stripes[x/10])
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 16
+
+	_, stats := CreateMosaicWithStats(img, opts)
+	if stats.ColorsUsed != 3 {
+		t.Errorf("ColorsUsed = %d, want 3", stats.ColorsUsed)
+	}
+	if len(stats.Palette) != opts.K {
+		t.Errorf("got %d palette colors, want %d", len(stats.Palette), opts.K)
+	}
+
+	opts.PruneUnused = true
+	_, stats = CreateMosaicWithStats(img, opts)
+	if len(stats.Palette) != 3 || len(stats.ClusterSizes) != 3 {
+		t.Fatalf("pruned palette = %v with cluster sizes %v, want 3 colors", stats.Palette, stats.ClusterSizes)
+	}
+	for _, c := range stats.Palette {
+		if c != stripes[0] && c != stripes[1] && c != stripes[2] {
+			t.Errorf("pruned palette color %v is not an image color", c)
+		}
+	}
+}
+
+func TestKmeansMergeThreshold(t *testing.T) {
+	// Create test image with two nearly equal blues
+	width, height := 40, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 20 {
+				img.Set(x, y, color.RGBA{B: 200, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 205, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 8
+
+	_, stats := CreateMosaicWithStats(img, opts)
+	if stats.ColorsUsed != 2 {
+		t.Fatalf("without merging ColorsUsed = %d, want 2", stats.ColorsUsed)
+	}
+
+	opts.MergeThreshold = 0.05
+	_, stats = CreateMosaicWithStats(img, opts)
+	if len(stats.Palette) != 1 {
+		t.Errorf("merged palette = %v, want a single color", stats.Palette)
+	}
+	if len(stats.ClusterSizes) != 1 || stats.ClusterSizes[0] != width*height {
+		t.Errorf("merged ClusterSizes = %v, want [%d]", stats.ClusterSizes, width*height)
+	}
+}
+
+func TestPixelColorRoundTrip(t *testing.T) {
+	colors := []color.Color{
+		color.RGBA{A: 255},
+		color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		color.RGBA{R: 1, G: 128, B: 254, A: 255},
+		color.RGBA{R: 77, G: 3, B: 200, A: 255},
+		color.Gray{Y: 99},
+		color.RGBA64{R: 0x8000, G: 0x4000, B: 0xffff, A: 0xffff},
+	}
+
+	for _, c := range colors {
+		r, g, b, _ := c.RGBA()
+		got := PixelFromColor(c).ToRGBA()
+		want := []uint32{r >> 8, g >> 8, b >> 8}
+		for i, v := range []uint8{got.R, got.G, got.B} {
+			if d := int(v) - int(want[i]); d < -1 || d > 1 {
+				t.Errorf("round trip of %v = %v, want within 1 of %v", c, got, want)
+				break
+			}
+		}
+		if got.A != 255 {
+			t.Errorf("round trip of %v alpha = %d, want 255", c, got.A)
+		}
+	}
+}
+
+func TestPixelToRGBARounding(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Pixel
+		want color.RGBA
+	}{
+		{"rounds up", Pixel{R: 0.999, G: 0.999, B: 0.999}, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{"rounds to nearest", Pixel{R: 0.5, G: 0.002, B: 0.001}, color.RGBA{R: 128, G: 1, B: 0, A: 255}},
+		{"clamps", Pixel{R: -0.2, G: 1.5, B: 0}, color.RGBA{G: 255, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.ToRGBA(); got != tt.want {
+				t.Errorf("%v.ToRGBA() = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateMosaicNoQuantize(t *testing.T) {
+	// Create test image with a horizontal gradient
+	width, height := 100, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(x * 255 / width)
+			img.Set(x, y, color.RGBA{R: v, G: v, B: 255 - v, A: 255})
+		}
+	}
+
+	for _, layout := range []BlockLayout{LayoutGrid, LayoutHex} {
+		opts := DefaultOptions()
+		opts.K = 2
+		opts.NoQuantize = true
+		opts.BlockLayout = layout
+
+		result := CreateMosaic(img, opts)
+
+		colors := make(map[color.Color]bool)
+		for x := 0; x < width; x++ {
+			colors[result.At(x, 5)] = true
+		}
+		if len(colors) <= opts.K {
+			t.Errorf("layout %d: %d distinct colors, want more than K = %d", layout, len(colors), opts.K)
+		}
+	}
+
+	// Each grid block is its own average color
+	opts := DefaultOptions()
+	opts.NoQuantize = true
+	result := CreateMosaic(img, opts)
+	want := averagePixels(imageToPixels(img, &Region{X: 20, Y: 0, Width: 10, Height: 10})).ToRGBA()
+	if got := result.At(25, 5); got != want {
+		t.Errorf("block color = %v, want average %v", got, want)
+	}
+}
+
+func TestPixelReader(t *testing.T) {
+	width, height := 17, 9
+	rgba := image.NewRGBA(image.Rect(3, 2, 3+width, 2+height))
+	nrgba := image.NewNRGBA(rgba.Bounds())
+	for y := rgba.Bounds().Min.Y; y < rgba.Bounds().Max.Y; y++ {
+		for x := rgba.Bounds().Min.X; x < rgba.Bounds().Max.X; x++ {
+			rgba.Set(x, y, color.RGBA{R: uint8(x * 15), G: uint8(y * 27), B: uint8(x * y), A: 255})
+			nrgba.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 15), G: uint8(y * 27), B: uint8(x * y), A: uint8(x*y*7 + 1)})
+		}
+	}
+	// A sub-image has a different stride from its bounds
+	sub := rgba.SubImage(image.Rect(5, 4, 12, 8)).(*image.RGBA)
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"RGBA", rgba},
+		{"NRGBA", nrgba},
+		{"RGBA sub-image", sub},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			region := resolveRegion(tt.img.Bounds(), nil)
+			got := imageToPixels(tt.img, region)
+
+			// The generic path reads through the color.Color interface
+			var want []Pixel
+			for y := region.Y; y < region.Y+region.Height; y++ {
+				for x := region.X; x < region.X+region.Width; x++ {
+					want = append(want, PixelFromColor(tt.img.At(x, y)))
+				}
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("imageToPixels() returned %d pixels, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("pixel %d = %v, want %v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPixelReader(b *testing.B) {
+	img := image.NewRGBA(image.Rect(0, 0, 512, 512))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 31)
+	}
+	region := resolveRegion(img.Bounds(), nil)
+
+	// Hiding the concrete type forces the generic At path
+	type genericImage struct{ image.Image }
+
+	for _, bm := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"Pix", img},
+		{"At", genericImage{img}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				imageToPixels(bm.img, region)
+			}
+		})
+	}
+}
+
+func TestInitCentroidsFixedSampling(t *testing.T) {
+	// Create a gradient of distinct colors
+	pixels := make([]Pixel, 100)
+	for i := range pixels {
+		v := float64(i) / 100
+		pixels[i] = Pixel{R: v, G: 1 - v, B: v / 2}
+	}
+
+	first := initCentroids(pixels, 4, InitFixedSampling, rand.New(rand.NewSource(1)))
+	second := initCentroids(pixels, 4, InitFixedSampling, rand.New(rand.NewSource(2)))
+
+	want := []Pixel{pixels[12], pixels[37], pixels[62], pixels[87]}
+	for i := range want {
+		if first[i] != want[i] || second[i] != want[i] {
+			t.Errorf("centroid %d = %v then %v, want %v", i, first[i], second[i], want[i])
+		}
+	}
+
+	// The whole palette is then reproducible
+	img := noiseImage(40, 40)
+	opts := DefaultOptions()
+	opts.InitMethod = InitFixedSampling
+	_, stats1 := CreateMosaicWithStats(img, opts)
+	_, stats2 := CreateMosaicWithStats(img, opts)
+	if fmt.Sprint(stats1.Palette) != fmt.Sprint(stats2.Palette) {
+		t.Errorf("palettes differ between runs: %v and %v", stats1.Palette, stats2.Palette)
+	}
+}
+
+func TestClamp01(t *testing.T) {
+	tests := []struct {
+		v, want float64
+	}{
+		{-0.5, 0},
+		{0, 0},
+		{0.25, 0.25},
+		{1, 1},
+		{1.0001, 1},
+	}
+
+	for _, tt := range tests {
+		if got := clamp01(tt.v); got != tt.want {
+			t.Errorf("clamp01(%v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestOvershootingCentroid(t *testing.T) {
+	// A centroid component slightly above 1 saturates instead of wrapping
+	centroid := Pixel{R: 1.0001, G: -0.0001, B: 0.5}
+	if got := centroid.ToRGBA(); got.R != 255 || got.G != 0 {
+		t.Errorf("ToRGBA() = %v, want R 255 and G 0", got)
+	}
+	if got := pixelToRGBA64(centroid); got.R != 65535 || got.G != 0 {
+		t.Errorf("pixelToRGBA64() = %v, want R 65535 and G 0", got)
+	}
+
+	// A color transform pushing every block above 1 paints saturated blocks
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+	opts := DefaultOptions()
+	opts.K = 1
+	opts.ColorTransform = func(p Pixel) Pixel {
+		return Pixel{R: p.R * 1.5, G: p.G, B: p.B}
+	}
+	result := CreateMosaic(img, opts)
+	if got := result.At(5, 5).(color.RGBA); got.R != 255 {
+		t.Errorf("block color = %v, want R 255", got)
+	}
+}
+
+func TestConvergenceMode(t *testing.T) {
+	// A clustered image and a low-contrast copy scaled to 5% of its range
+	rng := rand.New(rand.NewSource(1))
+	high := make([]Pixel, 2000)
+	low := make([]Pixel, len(high))
+	for i := range high {
+		center := float64(i%4) / 3
+		high[i] = Pixel{R: center + rng.Float64()*0.3, G: rng.Float64(), B: center * rng.Float64()}
+		low[i] = Pixel{R: high[i].R * 0.05, G: high[i].G * 0.05, B: high[i].B * 0.05}
+	}
+
+	iterations := func(pixels []Pixel, mode ConvergenceMode) int {
+		opts := DefaultOptions()
+		opts.K = 4
+		opts.Iterations = 200
+		opts.Tolerance = 0.01
+		opts.InitMethod = InitFixedSampling
+		opts.ConvergenceMode = mode
+		_, stats := kmeans(pixels, opts)
+		if !stats.Converged {
+			t.Fatalf("mode %d did not converge", mode)
+		}
+		return stats.IterationsRun
+	}
+
+	// Absolute tolerance stops early on the low-contrast copy, since all of
+	// its moves are small
+	absHigh, absLow := iterations(high, ConvergenceAbsolute), iterations(low, ConvergenceAbsolute)
+	if absLow >= absHigh {
+		t.Errorf("absolute iterations = %d (low contrast), %d (high contrast), want fewer for low contrast", absLow, absHigh)
+	}
+
+	// Relative tolerance is scale-invariant
+	relHigh, relLow := iterations(high, ConvergenceRelative), iterations(low, ConvergenceRelative)
+	if relLow != relHigh {
+		t.Errorf("relative iterations = %d (low contrast), %d (high contrast), want equal", relLow, relHigh)
+	}
+}
+
+func TestMinIterations(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pixels := randomPixels(rng, 2000)
+
+	tests := []struct {
+		name   string
+		modify func(*MosaicOptions)
+	}{
+		{"lloyd", func(o *MosaicOptions) {}},
+		{"workers", func(o *MosaicOptions) { o.Workers = 2 }},
+		{"mini-batch", func(o *MosaicOptions) { o.ClusterAlgorithm = AlgoMiniBatch }},
+		{"histogram", func(o *MosaicOptions) { o.UseHistogram = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A tolerance no move can reach converges after the first pass
+			opts := DefaultOptions()
+			opts.Tolerance = 10
+			opts.InitMethod = InitPlusPlus
+			opts.Seed = 1
+			tt.modify(opts)
+
+			if _, stats := kmeans(pixels, opts); stats.IterationsRun != 1 {
+				t.Errorf("IterationsRun = %d without MinIterations, want 1", stats.IterationsRun)
+			}
+
+			opts.MinIterations = 5
+			_, stats := kmeans(pixels, opts)
+			if stats.IterationsRun != 5 || !stats.Converged {
+				t.Errorf("IterationsRun = %d, Converged = %v, want 5 and true", stats.IterationsRun, stats.Converged)
+			}
+		})
+	}
+}
+
+func TestFindNearestCentroidIndexTieBreak(t *testing.T) {
+	// The pixel is exactly between the two centroids
+	dark := Pixel{R: 0.25, G: 0.5, B: 0.5}
+	light := Pixel{R: 0.75, G: 0.5, B: 0.5}
+	p := Pixel{R: 0.5, G: 0.5, B: 0.5}
+
+	tests := []struct {
+		name      string
+		centroids []Pixel
+		want      int
+	}{
+		{"smaller first", []Pixel{dark, light}, 0},
+		{"smaller last", []Pixel{light, dark}, 1},
+		{"after a farther centroid", []Pixel{{R: 1, G: 1, B: 1}, light, dark}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findNearestCentroidIndex(p, tt.centroids, distanceSquared)
+			if got != tt.want || tt.centroids[got] != dark {
+				t.Errorf("findNearestCentroidIndex() = %d (%v), want %d (%v)", got, tt.centroids[got], tt.want, dark)
+			}
+		})
+	}
+}
+
+func TestCreateMosaicSubImageOrigin(t *testing.T) {
+	// Create an image whose sub-image at (50,50) has a distinct color per
+	// 10x10 cell, and an unshifted copy of the same pixels
+	full := image.NewRGBA(image.Rect(0, 0, 120, 120))
+	shifted := image.NewRGBA(image.Rect(0, 0, 50, 50))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 120; x++ {
+			c := color.RGBA{R: uint8(x / 10 * 20), G: uint8(y / 10 * 20), B: uint8((x + y) % 7), A: 255}
+			full.Set(x, y, c)
+			if x >= 50 && x < 100 && y >= 50 && y < 100 {
+				shifted.Set(x-50, y-50, c)
+			}
+		}
+	}
+	sub := full.SubImage(image.Rect(50, 50, 100, 100))
+
+	tests := []struct {
+		name   string
+		layout BlockLayout
+		region *Region // in sub-image coordinates
+	}{
+		{"grid", LayoutGrid, nil},
+		{"region", LayoutGrid, &Region{X: 60, Y: 55, Width: 25, Height: 30}},
+		{"hex", LayoutHex, nil},
+		{"stripes", LayoutHStripe, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.K = 25
+			opts.InitMethod = InitFixedSampling
+			opts.BlockLayout = tt.layout
+			opts.Region = tt.region
+
+			result := CreateMosaic(sub, opts)
+			if result.Bounds() != sub.Bounds() {
+				t.Fatalf("bounds = %v, want %v", result.Bounds(), sub.Bounds())
+			}
+
+			// The same pixels at the origin give the same mosaic, offset by (50,50)
+			shiftedOpts := *opts
+			if tt.region != nil {
+				shiftedOpts.Region = &Region{X: tt.region.X - 50, Y: tt.region.Y - 50, Width: tt.region.Width, Height: tt.region.Height}
+			}
+			want := CreateMosaic(shifted, &shiftedOpts)
+			for y := 0; y < 50; y++ {
+				for x := 0; x < 50; x++ {
+					if got, w := result.At(x+50, y+50), want.At(x, y); got != w {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x+50, y+50, got, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInitPlusPlusSeed(t *testing.T) {
+	img := noiseImage(40, 40)
+	palette := func(seed int64) string {
+		opts := DefaultOptions()
+		opts.K = 4
+		opts.InitMethod = InitPlusPlus
+		opts.Seed = seed
+		_, stats := CreateMosaicWithStats(img, opts)
+		return fmt.Sprint(stats.Palette)
+	}
+
+	// The same seed gives the same centroids
+	for _, seed := range []int64{1, 42} {
+		if first, second := palette(seed), palette(seed); first != second {
+			t.Errorf("seed %d: palettes differ between runs: %v and %v", seed, first, second)
+		}
+	}
+
+	// Different seeds can settle on different centroids of the noise
+	palettes := make(map[string]bool)
+	for seed := int64(1); seed <= 10; seed++ {
+		palettes[palette(seed)] = true
+	}
+	if len(palettes) < 2 {
+		t.Errorf("10 seeds gave %d distinct palettes, want several", len(palettes))
+	}
+}
+
+func TestInitPlusPlusDistinctColors(t *testing.T) {
+	// Many pixels of one color and a few of two others
+	pixels := make([]Pixel, 100)
+	pixels[40] = Pixel{R: 1}
+	pixels[80] = Pixel{B: 1}
+
+	for seed := int64(1); seed <= 20; seed++ {
+		centroids := initCentroids(pixels, 3, InitPlusPlus, rand.New(rand.NewSource(seed)))
+		for _, want := range []Pixel{{}, {R: 1}, {B: 1}} {
+			if !containsPixel(centroids, want) {
+				t.Errorf("seed %d: centroids %v miss %v", seed, centroids, want)
+			}
+		}
+	}
+}
+
+// splitGIF is a single-frame 20x10 GIF, red on the left and blue on the right
+//
+//go:embed testdata/split.gif
+var splitGIF []byte
+
+func TestDecodeGIF(t *testing.T) {
+	img, format, err := image.Decode(bytes.NewReader(splitGIF))
+	if err != nil {
+		t.Fatalf("image.Decode() error = %v", err)
+	}
+	if format != "gif" {
+		t.Errorf("format = %q, want gif", format)
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	result := CreateMosaicRGBA(img, opts)
+	if got := result.RGBAAt(5, 5); got != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("left pixel = %v, want red", got)
+	}
+	if got := result.RGBAAt(15, 5); got != (color.RGBA{B: 255, A: 255}) {
+		t.Errorf("right pixel = %v, want blue", got)
+	}
+}
+
+func TestCreateMosaicClipsBlocksToRegion(t *testing.T) {
+	// Create a gradient so that painted pixels differ from the original
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: 100, A: 255})
+		}
+	}
+
+	tests := []struct {
+		name  string
+		shape BlockShape
+	}{
+		{"square", BlockSquare},
+		{"circle", BlockCircle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The third block column straddles the region's right edge at x=25
+			opts := DefaultOptions()
+			opts.K = 2
+			opts.BlockShape = tt.shape
+			opts.Region = &Region{X: 0, Y: 0, Width: 25, Height: 20}
+
+			result := CreateMosaicRGBA(img, opts)
+
+			for y := 0; y < 20; y++ {
+				for x := 25; x < 40; x++ {
+					if got, want := result.RGBAAt(x, y), img.RGBAAt(x, y); got != want {
+						t.Fatalf("pixel (%d,%d) past the region = %v, want original %v", x, y, got, want)
+					}
+				}
+			}
+			if got := result.RGBAAt(22, 5); got == img.RGBAAt(22, 5) {
+				t.Errorf("pixel (22,5) inside the region kept its original color")
+			}
+		})
+	}
+}
+
+func TestCreateMosaicInto(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 12), B: 100, A: 255})
+		}
+	}
+
+	// Layer two regions with different palettes onto a white canvas
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+
+	left := DefaultOptions()
+	left.Region = &Region{X: 0, Y: 0, Width: 10, Height: 10}
+	left.Palette = []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}}
+	right := DefaultOptions()
+	right.Region = &Region{X: 20, Y: 10, Width: 20, Height: 10}
+	right.K = 3
+	right.InitMethod = InitFixedSampling
+
+	for _, opts := range []*MosaicOptions{left, right} {
+		if err := CreateMosaicInto(dst, img, opts); err != nil {
+			t.Fatalf("CreateMosaicInto() error = %v", err)
+		}
+	}
+
+	// Each region matches its own mosaic and the rest of dst stays white
+	wantLeft := CreateMosaicRGBA(img, left)
+	wantRight := CreateMosaicRGBA(img, right)
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			p := image.Pt(x, y)
+			want := white
+			switch {
+			case p.In(left.Region.rect()):
+				want = wantLeft.RGBAAt(x, y)
+			case p.In(right.Region.rect()):
+				want = wantRight.RGBAAt(x, y)
+			}
+			if got := dst.RGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	if err := CreateMosaicInto(image.NewRGBA(image.Rect(0, 0, 5, 5)), img, nil); err == nil {
+		t.Errorf("CreateMosaicInto() with mismatched bounds error = nil, want error")
+	}
+}
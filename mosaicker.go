@@ -0,0 +1,99 @@
+package mosaic
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// Mosaicker applies the same options to many same-size images, such as the
+// frames of a video, reusing its internal buffers across calls. A Mosaicker
+// is not safe for concurrent use; use one per goroutine.
+type Mosaicker struct {
+	opts MosaicOptions
+}
+
+// NewMosaicker returns a Mosaicker using a copy of opts (nil for the
+// defaults)
+func NewMosaicker(opts *MosaicOptions) *Mosaicker {
+	opts = opts.Normalize()
+	m := &Mosaicker{opts: *opts}
+	m.opts.buffers = &buffers{}
+	return m
+}
+
+// Process writes the mosaic of src to dst, which must have the same bounds.
+// CollapseBlocks is not supported since its output has a different size.
+func (m *Mosaicker) Process(dst *image.RGBA, src image.Image) error {
+	if dst.Bounds() != src.Bounds() {
+		return fmt.Errorf("mosaic: destination bounds %v do not match source bounds %v", dst.Bounds(), src.Bounds())
+	}
+	if m.opts.CollapseBlocks {
+		return errors.New("mosaic: CollapseBlocks is not supported by Mosaicker")
+	}
+
+	renderMosaic(dst, src, &m.opts, true)
+	return nil
+}
+
+// buffers holds slices reused across calls by a Mosaicker. A nil *buffers
+// allocates new slices every time.
+type buffers struct {
+	pixels   []Pixel
+	clusters [][]Pixel
+	dists    []float64
+	planes   pixelPlanes
+}
+
+// pixelSlice returns an empty slice backed by the reused pixel buffer
+func (b *buffers) pixelSlice() []Pixel {
+	if b == nil {
+		return nil
+	}
+	return b.pixels[:0]
+}
+
+// keepPixels stores pixels, which may have grown, for reuse by later calls
+func (b *buffers) keepPixels(pixels []Pixel) {
+	if b != nil {
+		b.pixels = pixels
+	}
+}
+
+// clusterSlices returns k empty cluster slices
+func (b *buffers) clusterSlices(k int) [][]Pixel {
+	if b == nil {
+		return make([][]Pixel, k)
+	}
+	b.clusters = grow(b.clusters, k)
+	return b.clusters
+}
+
+// distances returns a slice of n distances with unspecified contents
+func (b *buffers) distances(n int) []float64 {
+	if b == nil {
+		return make([]float64, n)
+	}
+	b.dists = grow(b.dists, n)
+	return b.dists
+}
+
+// pixelPlanes splits pixels into channel planes, reusing the plane buffers
+func (b *buffers) pixelPlanes(pixels []Pixel) *pixelPlanes {
+	if b == nil {
+		return newPixelPlanes(pixels)
+	}
+	n := len(pixels)
+	b.planes.r, b.planes.g, b.planes.b = grow(b.planes.r, n), grow(b.planes.g, n), grow(b.planes.b, n)
+	b.planes.fill(pixels)
+	return &b.planes
+}
+
+// grow returns s resliced to length n, or a new slice if its capacity is
+// too small
+func grow[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	return s[:n]
+}
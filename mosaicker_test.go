@@ -0,0 +1,125 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"sync"
+	"testing"
+)
+
+// frameImage returns a frame of four color quadrants shifted by offset pixels
+func frameImage(width, height, offset int) *image.RGBA {
+	colors := []color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{B: 255, A: 255},
+		{R: 255, G: 255, A: 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			quadrant := ((x+offset)%width*2/width)*2 + y*2/height
+			img.Set(x, y, colors[quadrant])
+		}
+	}
+	return img
+}
+
+func TestMosaickerProcess(t *testing.T) {
+	opts := DefaultOptions()
+	opts.K = 4
+	m := NewMosaicker(opts)
+	dst := image.NewRGBA(image.Rect(0, 0, 40, 40))
+
+	// Every frame matches CreateMosaic, including after buffers are reused
+	for offset := 0; offset < 3; offset++ {
+		src := frameImage(40, 40, offset*7)
+		if err := m.Process(dst, src); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+
+		want := CreateMosaic(src, opts)
+		for y := 0; y < 40; y++ {
+			for x := 0; x < 40; x++ {
+				if got := dst.At(x, y); got != want.At(x, y) {
+					t.Fatalf("frame %d pixel (%d,%d) = %v, want %v", offset, x, y, got, want.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestMosaickerProcessErrors(t *testing.T) {
+	src := frameImage(20, 20, 0)
+
+	tests := []struct {
+		name string
+		opts *MosaicOptions
+		dst  *image.RGBA
+	}{
+		{"bounds mismatch", nil, image.NewRGBA(image.Rect(0, 0, 10, 20))},
+		{"collapse blocks", &MosaicOptions{K: 2, BlockSize: 5, Iterations: 10, CollapseBlocks: true}, image.NewRGBA(src.Bounds())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewMosaicker(tt.opts).Process(tt.dst, src); err == nil {
+				t.Error("Process() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMosaickerPerGoroutine(t *testing.T) {
+	// Mosaickers share nothing, so using one per goroutine is race-free
+	// under the race detector
+	opts := DefaultOptions()
+	opts.K = 4
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			m := NewMosaicker(opts)
+			dst := image.NewRGBA(image.Rect(0, 0, 40, 40))
+			for frame := 0; frame < 3; frame++ {
+				if err := m.Process(dst, frameImage(40, 40, offset+frame)); err != nil {
+					t.Errorf("Process() error = %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkMosaicker(b *testing.B) {
+	const frameCount = 60
+	frames := make([]*image.RGBA, frameCount)
+	for i := range frames {
+		frames[i] = frameImage(160, 120, i)
+	}
+	opts := DefaultOptions()
+	opts.K = 4
+
+	b.Run("CreateMosaic", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, frame := range frames {
+				CreateMosaic(frame, opts)
+			}
+		}
+	})
+	b.Run("Mosaicker", func(b *testing.B) {
+		b.ReportAllocs()
+		m := NewMosaicker(opts)
+		dst := image.NewRGBA(frames[0].Bounds())
+		for i := 0; i < b.N; i++ {
+			for _, frame := range frames {
+				if err := m.Process(dst, frame); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
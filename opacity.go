@@ -0,0 +1,54 @@
+package mosaic
+
+import (
+	"image"
+	"image/draw"
+)
+
+// blendOpacity mixes the painted pixels of the regions with the original
+// image, keeping opacity of the mosaic, less within feather pixels of a
+// region's border. Pixels covered by several regions are blended once, by
+// the region they lie deepest in, and pixels the mosaic left unchanged are
+// skipped.
+func blendOpacity(mosaic draw.Image, img image.Image, regions []*Region, opacity float64, feather int) {
+	bounds := img.Bounds()
+	original := pixelReader(img)
+	painted := pixelReader(mosaic)
+
+	// Weigh the mosaic at every covered pixel, zero meaning not covered
+	weights := make([]float64, bounds.Dx()*bounds.Dy())
+	for _, region := range regions {
+		rect := region.rect().Intersect(bounds)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if !region.contains(x, y) {
+					continue
+				}
+				w := 1.0
+				if feather > 0 {
+					w = min(1, region.edgeDistance(x, y, bounds)/float64(feather))
+				}
+				i := (y-bounds.Min.Y)*bounds.Dx() + (x - bounds.Min.X)
+				weights[i] = max(weights[i], w*opacity)
+			}
+		}
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			w := weights[(y-bounds.Min.Y)*bounds.Dx()+(x-bounds.Min.X)]
+			if w == 0 || w == 1 {
+				continue
+			}
+			p, o := painted(x, y), original(x, y)
+			if p == o {
+				continue
+			}
+			mosaic.Set(x, y, outputColor(mosaic, Pixel{
+				R: o.R + (p.R-o.R)*w,
+				G: o.G + (p.G-o.G)*w,
+				B: o.B + (p.B-o.B)*w,
+			}))
+		}
+	}
+}
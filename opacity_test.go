@@ -0,0 +1,92 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOpacity(t *testing.T) {
+	// Create a red image painted with a fixed blue palette
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	tests := []struct {
+		name    string
+		opacity float64
+		want    color.RGBA
+	}{
+		{"zero is unset and opaque", 0, color.RGBA{B: 255, A: 255}},
+		{"opaque", 1, color.RGBA{B: 255, A: 255}},
+		{"half", 0.5, color.RGBA{R: 128, B: 128, A: 255}},
+		{"quarter", 0.25, color.RGBA{R: 191, B: 64, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Palette = []color.RGBA{{B: 255, A: 255}}
+			opts.Opacity = tt.opacity
+			opts.Regions = []*Region{{X: 0, Y: 0, Width: 10, Height: 20}, {X: 5, Y: 0, Width: 10, Height: 20}}
+
+			result := CreateMosaicRGBA(img, opts)
+
+			// Overlapping regions are blended once
+			for _, x := range []int{2, 7, 12} {
+				if got := result.RGBAAt(x, 5); got != tt.want {
+					t.Errorf("pixel (%d,5) = %v, want %v", x, got, tt.want)
+				}
+			}
+			// Pixels outside the regions keep the original
+			if got := result.RGBAAt(17, 5); got != (color.RGBA{R: 255, A: 255}) {
+				t.Errorf("outside pixel = %v, want original red", got)
+			}
+		})
+	}
+}
+
+func TestFeatherRadius(t *testing.T) {
+	// Create a red image painted with a fixed blue palette
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+
+	opts := DefaultOptions()
+	opts.Palette = []color.RGBA{blue}
+	opts.FeatherRadius = 4
+	opts.Region = &Region{X: 10, Y: 0, Width: 20, Height: 20}
+
+	result := CreateMosaicRGBA(img, opts)
+
+	// Half the radius inside the left border is a blend of both
+	if got := result.RGBAAt(12, 10); got == red || got == blue || got.R == 0 || got.B == 0 {
+		t.Errorf("pixel (12,10) = %v, want a blend of %v and %v", got, red, blue)
+	}
+	// The blend fades toward the border
+	if inner, outer := result.RGBAAt(12, 10), result.RGBAAt(10, 10); outer.B >= inner.B {
+		t.Errorf("pixel (10,10) = %v, want less blue than (12,10) = %v", outer, inner)
+	}
+
+	tests := []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{"deep inside", 20, 10, blue},
+		{"on the image edge", 20, 0, blue},
+		{"outside", 5, 10, red},
+	}
+	for _, tt := range tests {
+		if got := result.RGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("%s pixel (%d,%d) = %v, want %v", tt.name, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
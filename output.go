@@ -0,0 +1,36 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// newOutputImage allocates the mosaic output for img, keeping the color model
+// of Gray, Gray16 and NRGBA inputs and falling back to RGBA otherwise. Gray
+// models cannot hold the transparency of AutoKeyBackground and use RGBA then.
+func newOutputImage(img image.Image, opts *MosaicOptions) draw.Image {
+	bounds := img.Bounds()
+	switch img.(type) {
+	case *image.Gray:
+		if !opts.AutoKeyBackground {
+			return image.NewGray(bounds)
+		}
+	case *image.Gray16:
+		if !opts.AutoKeyBackground {
+			return image.NewGray16(bounds)
+		}
+	case *image.NRGBA:
+		return image.NewNRGBA(bounds)
+	}
+	return image.NewRGBA(bounds)
+}
+
+// outputColor converts a pixel to the color painted into out, keeping 16 bits
+// per channel for 16-bit outputs
+func outputColor(out image.Image, p Pixel) color.Color {
+	if out.ColorModel() == color.Gray16Model {
+		return pixelToRGBA64(p)
+	}
+	return p.ToRGBA()
+}
@@ -0,0 +1,193 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestCreateMosaicKeepsColorModel(t *testing.T) {
+	bounds := image.Rect(0, 0, 20, 20)
+
+	tests := []struct {
+		name string
+		img  image.Image
+		want image.Image
+	}{
+		{"Gray", image.NewGray(bounds), &image.Gray{}},
+		{"Gray16", image.NewGray16(bounds), &image.Gray16{}},
+		{"NRGBA", image.NewNRGBA(bounds), &image.NRGBA{}},
+		{"CMYK", image.NewCMYK(bounds), &image.RGBA{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CreateMosaic(tt.img, DefaultOptions())
+			if got, want := reflect.TypeOf(result), reflect.TypeOf(tt.want); got != want {
+				t.Errorf("result type = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCreateMosaicGray16Depth(t *testing.T) {
+	// A uniform 16-bit gray that is not representable in 8 bits
+	width, height := 20, 20
+	gray := color.Gray16{Y: 0x1234}
+	img := image.NewGray16(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray16(x, y, gray)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 1
+
+	result, ok := CreateMosaic(img, opts).(*image.Gray16)
+	if !ok {
+		t.Fatalf("result is %T, want *image.Gray16", result)
+	}
+	if got := result.Gray16At(5, 5); got.Y < gray.Y-1 || got.Y > gray.Y+1 {
+		t.Errorf("pixel = %v, want %v", got, gray)
+	}
+}
+
+func TestCreateMosaicRGBA(t *testing.T) {
+	bounds := image.Rect(0, 0, 20, 20)
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"RGBA", image.NewRGBA(bounds)},
+		{"Gray", image.NewGray(bounds)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CreateMosaicRGBA(tt.img, DefaultOptions())
+			if result.Stride != 4*bounds.Dx() {
+				t.Errorf("Stride = %d, want %d", result.Stride, 4*bounds.Dx())
+			}
+			if len(result.Pix) != 4*bounds.Dx()*bounds.Dy() {
+				t.Errorf("len(Pix) = %d, want %d", len(result.Pix), 4*bounds.Dx()*bounds.Dy())
+			}
+			if result.Bounds() != bounds {
+				t.Errorf("Bounds() = %v, want %v", result.Bounds(), bounds)
+			}
+		})
+	}
+}
+
+func TestCreateMosaicPaletted(t *testing.T) {
+	// Create test image with three color bands
+	width, height := 30, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	bands := []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, bands[x/10])
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 5
+	paletted := CreateMosaicPaletted(img, opts)
+
+	// Only the three used colors make up the palette
+	if len(paletted.Palette) != 3 {
+		t.Errorf("palette = %v, want the 3 used colors", paletted.Palette)
+	}
+
+	want := CreateMosaicRGBA(img, opts)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			got := color.RGBAModel.Convert(paletted.At(x, y)).(color.RGBA)
+			w := want.RGBAAt(x, y)
+			if absDiff(got.R, w.R) > 1 || absDiff(got.G, w.G) > 1 || absDiff(got.B, w.B) > 1 {
+				t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, w)
+			}
+		}
+	}
+}
+
+func TestCreateMosaicPalettedClampsK(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8(x ^ y), A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 1000
+	opts.BlockSize = 1
+	opts.Iterations = 2
+	if n := len(CreateMosaicPaletted(img, opts).Palette); n > 256 {
+		t.Errorf("palette has %d colors, want at most 256", n)
+	}
+}
+
+func TestCreateMosaicPalettedCombinedPalettes(t *testing.T) {
+	width, height := 200, 200
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x*y) ^ uint8(x+y), A: 255})
+		}
+	}
+	left := &Region{X: 0, Y: 0, Width: width / 2, Height: height}
+	right := &Region{X: width / 2, Y: 0, Width: width / 2, Height: height}
+
+	fixed := make([]color.RGBA, 300)
+	for i := range fixed {
+		fixed[i] = color.RGBA{R: uint8(i), G: uint8(i * 7), B: uint8(i * 13), A: 255}
+	}
+
+	// Each case exceeds 256 colors, and the clamped options are what
+	// CreateMosaicPaletted paints with
+	tests := []struct {
+		name           string
+		options        func(*MosaicOptions)
+		clampedOptions func(*MosaicOptions)
+	}{
+		{
+			"region specs",
+			func(o *MosaicOptions) { o.RegionSpecs = []RegionSpec{{Region: left, K: 200}, {Region: right, K: 200}} },
+			func(o *MosaicOptions) { o.RegionSpecs = []RegionSpec{{Region: left, K: 128}, {Region: right, K: 128}} },
+		},
+		{
+			"large fixed palette",
+			func(o *MosaicOptions) { o.Palette = fixed },
+			func(o *MosaicOptions) { o.Palette = fixed[:256] },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.BlockSize = 2
+			opts.Iterations = 3
+			opts.InitMethod = InitPlusPlus
+			opts.Seed = 1
+
+			tt.options(opts)
+			paletted := CreateMosaicPaletted(img, opts)
+			if n := len(paletted.Palette); n > 256 {
+				t.Fatalf("palette has %d colors, want at most 256", n)
+			}
+
+			tt.clampedOptions(opts)
+			want := CreateMosaicRGBA(img, opts)
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					if got := color.RGBAModel.Convert(paletted.At(x, y)).(color.RGBA); got != want.RGBAAt(x, y) {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want.RGBAAt(x, y))
+					}
+				}
+			}
+		})
+	}
+}
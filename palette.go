@@ -0,0 +1,149 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// ExtractPalette runs k-means clustering over the configured regions of the
+// image (Region, Regions or RegionSpecs) together and returns the resulting
+// colors sorted by cluster population (most common first), or by hue with
+// SortByHue. Clusters that end up empty are omitted, so fewer than K colors
+// are returned when the image has fewer distinct colors, and none when
+// nothing is left to cluster.
+// With a fixed Palette in the options, the palette colors the image uses are
+// returned instead. PruneUnused also drops colors no block is painted with.
+func ExtractPalette(img image.Image, opts *MosaicOptions) []color.RGBA {
+	opts = opts.Normalize()
+	opts = opts.withInvertedRegions()
+
+	regions := opts.regions(img.Bounds())
+	img = opts.preBlur(img, regions)
+	var pixels []Pixel
+	for _, region := range regions {
+		pixels = opts.appendPixels(pixels, img, region)
+	}
+	dist := opts.distanceFunc()
+	var centroids []Pixel
+	if len(opts.Palette) > 0 {
+		centroids = opts.paletteCentroids()
+	} else {
+		centroids, _ = kmeans(pixels, opts)
+	}
+	if len(centroids) == 0 {
+		return nil
+	}
+
+	// Count the population of each cluster
+	counts := make([]int, len(centroids))
+	for _, p := range pixels {
+		counts[findNearestCentroidIndex(p, centroids, dist)]++
+	}
+
+	// Only keep the colors blocks are painted with when pruning
+	used := make([]bool, len(centroids))
+	if opts.PruneUnused {
+		for i, region := range regions {
+			layout := opts
+			if len(opts.RegionSpecs) > 0 {
+				layout = opts.specOptions(opts.RegionSpecs[i])
+			}
+			rects := regionBlocks(img, region, layout)
+			for _, block := range planRegion(img, region, rects, centroids, dist, layout, nil) {
+				if block.index >= 0 {
+					used[block.index] = true
+				}
+			}
+		}
+	}
+
+	order := make([]int, 0, len(centroids))
+	for i, n := range counts {
+		if n > 0 && (used[i] || !opts.PruneUnused) {
+			order = append(order, i)
+		}
+	}
+	if !opts.SortByHue {
+		sort.SliceStable(order, func(a, b int) bool {
+			return counts[order[a]] > counts[order[b]]
+		})
+	}
+
+	palette := make([]color.RGBA, len(order))
+	for i, idx := range order {
+		palette[i] = opts.outputPixel(centroids[idx]).ToRGBA()
+	}
+
+	return palette
+}
+
+// ApplyMosaic creates a mosaic like CreateMosaic but skips clustering and
+// assigns every block the nearest of the given centroids, e.g. a palette
+// extracted once from a video keyframe to avoid flicker across frames. The
+// number of centroids takes the place of K. With no centroids the image is
+// returned unchanged.
+func ApplyMosaic(img image.Image, centroids []color.RGBA, opts *MosaicOptions) image.Image {
+	opts = opts.Normalize()
+	if len(centroids) == 0 {
+		out := newOutputImage(img, opts)
+		draw.Draw(out, img.Bounds(), img, img.Bounds().Min, draw.Src)
+		return out
+	}
+
+	fixed := *opts
+	fixed.Palette = centroids
+	return CreateMosaic(img, &fixed)
+}
+
+// PaletteSwatches renders a palette as a horizontal strip with one
+// swatchSize×swatchSize square per color, in order. An empty palette or a
+// non-positive swatchSize gives a zero-size image.
+func PaletteSwatches(palette []color.RGBA, swatchSize int) *image.RGBA {
+	if len(palette) == 0 || swatchSize <= 0 {
+		return image.NewRGBA(image.Rectangle{})
+	}
+
+	strip := image.NewRGBA(image.Rect(0, 0, len(palette)*swatchSize, swatchSize))
+	for i, c := range palette {
+		fillBlock(strip, image.Rect(i*swatchSize, 0, (i+1)*swatchSize, swatchSize), c)
+	}
+	return strip
+}
+
+// AverageColor returns the mean color of a region of the image (nil for the
+// entire image), rounded to 8 bits
+func AverageColor(img image.Image, region *Region) color.RGBA {
+	return averagePixels(imageToPixels(img, resolveRegion(img.Bounds(), region))).ToRGBA()
+}
+
+// NearestColor returns the index and color of the palette entry nearest to
+// c by squared RGB distance, ignoring alpha. Ties go to the smaller color, as
+// in clustering. It compares c against every entry, so each call costs
+// O(len(palette)) and allocates nothing. An empty palette gives index -1.
+func NearestColor(c color.RGBA, palette []color.RGBA) (int, color.RGBA) {
+	nearest, minDist := -1, 0
+	for i, p := range palette {
+		dr, dg, db := int(c.R)-int(p.R), int(c.G)-int(p.G), int(c.B)-int(p.B)
+		d := dr*dr + dg*dg + db*db
+		if nearest < 0 || d < minDist || (d == minDist && rgbLess(p, palette[nearest])) {
+			nearest, minDist = i, d
+		}
+	}
+	if nearest < 0 {
+		return -1, color.RGBA{}
+	}
+	return nearest, palette[nearest]
+}
+
+// rgbLess orders colors by red, then green, then blue, like pixelLess
+func rgbLess(a, b color.RGBA) bool {
+	if a.R != b.R {
+		return a.R < b.R
+	}
+	if a.G != b.G {
+		return a.G < b.G
+	}
+	return a.B < b.B
+}
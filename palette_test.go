@@ -0,0 +1,370 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestExtractPalette(t *testing.T) {
+	// Create test image with three colors of different populations
+	width, height := 10, 10
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	red := color.RGBA{R: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case x < 5:
+				img.Set(x, y, blue) // 50 pixels
+			case x < 8:
+				img.Set(x, y, red) // 30 pixels
+			default:
+				img.Set(x, y, green) // 20 pixels
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 5
+
+	got := ExtractPalette(img, opts)
+	expected := []color.RGBA{blue, red, green}
+
+	if len(got) != len(expected) {
+		t.Fatalf("ExtractPalette() returned %d colors, want %d: %v", len(got), len(expected), got)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("palette[%d] = %v, want %v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestExtractPaletteSnapGrid(t *testing.T) {
+	// newImage creates a test image split into two colors
+	newImage := func(left, right color.RGBA) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 10; x++ {
+				if x < 6 {
+					img.Set(x, y, left)
+				} else {
+					img.Set(x, y, right)
+				}
+			}
+		}
+		return img
+	}
+
+	img1 := newImage(color.RGBA{R: 250, G: 10, B: 10, A: 255}, color.RGBA{R: 10, G: 10, B: 245, A: 255})
+	img2 := newImage(color.RGBA{R: 245, G: 5, B: 12, A: 255}, color.RGBA{R: 12, G: 8, B: 250, A: 255})
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.PaletteSnapGrid = 4
+
+	palette1 := ExtractPalette(img1, opts)
+	palette2 := ExtractPalette(img2, opts)
+
+	if len(palette1) != len(palette2) {
+		t.Fatalf("palette lengths differ: %v vs %v", palette1, palette2)
+	}
+	for i := range palette1 {
+		if palette1[i] != palette2[i] {
+			t.Errorf("palette[%d] differs: %v vs %v", i, palette1[i], palette2[i])
+		}
+	}
+}
+
+func TestExtractPaletteGuide(t *testing.T) {
+	// Create test image with a near-red half and a blue half
+	width, height := 20, 10
+	nearRed := color.RGBA{R: 240, G: 12, B: 8, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < 10 {
+				img.Set(x, y, nearRed)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+
+	red := color.RGBA{R: 255, A: 255}
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.GuidePalette = []color.RGBA{red, {G: 255, A: 255}}
+	opts.GuideStrength = 0.1
+
+	got := ExtractPalette(img, opts)
+
+	// The near-red cluster snaps to the guide, the blue one has no guide
+	// close enough and stays image-derived
+	want := map[color.RGBA]bool{red: true, blue: true}
+	if len(got) != len(want) {
+		t.Fatalf("ExtractPalette() = %v, want %v and %v", got, red, blue)
+	}
+	for _, c := range got {
+		if !want[c] {
+			t.Errorf("palette color %v, want %v or %v", c, red, blue)
+		}
+	}
+}
+
+func TestExtractPaletteSortByHue(t *testing.T) {
+	// Rainbow stripes whose widths put the colors out of hue order by
+	// population
+	rainbow := []struct {
+		c     color.RGBA
+		width int
+	}{
+		{color.RGBA{R: 255, A: 255}, 2},
+		{color.RGBA{R: 255, G: 255, A: 255}, 6},
+		{color.RGBA{G: 255, A: 255}, 3},
+		{color.RGBA{G: 255, B: 255, A: 255}, 5},
+		{color.RGBA{B: 255, A: 255}, 1},
+		{color.RGBA{R: 255, B: 255, A: 255}, 4},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 21, 5))
+	x := 0
+	for _, stripe := range rainbow {
+		for end := x + stripe.width; x < end; x++ {
+			for y := 0; y < 5; y++ {
+				img.Set(x, y, stripe.c)
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = len(rainbow)
+	opts.BlockSize = 1
+	opts.InitMethod = InitPlusPlus
+	opts.Seed = 1
+	opts.SortByHue = true
+
+	got := ExtractPalette(img, opts)
+	if len(got) != len(rainbow) {
+		t.Fatalf("ExtractPalette() returned %d colors, want %d: %v", len(got), len(rainbow), got)
+	}
+	for i, stripe := range rainbow {
+		if got[i] != stripe.c {
+			t.Errorf("palette[%d] = %v, want %v", i, got[i], stripe.c)
+		}
+	}
+
+	// Block labels index the same hue-ordered palette
+	labels, palette := BlockLabels(img, opts)
+	for i, c := range palette {
+		if c != got[i] {
+			t.Fatalf("BlockLabels() palette = %v, want %v", palette, got)
+		}
+	}
+	for x, label := range labels[0] {
+		if want := img.RGBAAt(x, 0); palette[label] != want {
+			t.Errorf("block %d labeled %v, want %v", x, palette[label], want)
+		}
+	}
+}
+
+func TestExtractPaletteRegions(t *testing.T) {
+	// Red on the left half and blue on the right
+	img := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			if x < 10 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+	left := &Region{X: 0, Y: 0, Width: 10, Height: 10}
+
+	tests := []struct {
+		name   string
+		modify func(*MosaicOptions)
+	}{
+		{"Region", func(o *MosaicOptions) { o.Region = left }},
+		{"Regions", func(o *MosaicOptions) { o.Regions = []*Region{left} }},
+		{"RegionSpecs", func(o *MosaicOptions) { o.RegionSpecs = []RegionSpec{{Region: left}} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, prune := range []bool{false, true} {
+				opts := DefaultOptions()
+				opts.PruneUnused = prune
+				tt.modify(opts)
+				if got := ExtractPalette(img, opts); len(got) != 1 || got[0] != red {
+					t.Errorf("PruneUnused %v: ExtractPalette() = %v, want only red", prune, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPaletteNothingToCluster(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	opts := DefaultOptions()
+	opts.Region = &Region{X: 0, Y: 0, Width: 20, Height: 20, Invert: true}
+
+	for _, prune := range []bool{false, true} {
+		opts.PruneUnused = prune
+		if got := ExtractPalette(img, opts); len(got) != 0 {
+			t.Errorf("PruneUnused %v: ExtractPalette() = %v, want no colors", prune, got)
+		}
+	}
+}
+
+func TestPaletteSwatches(t *testing.T) {
+	palette := []color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{R: 10, G: 20, B: 30, A: 255},
+	}
+	size := 12
+
+	strip := PaletteSwatches(palette, size)
+
+	if got, want := strip.Bounds(), image.Rect(0, 0, len(palette)*size, size); got != want {
+		t.Fatalf("Bounds() = %v, want %v", got, want)
+	}
+	for i, c := range palette {
+		if got := strip.RGBAAt(i*size+size/2, size/2); got != c {
+			t.Errorf("swatch %d center = %v, want %v", i, got, c)
+		}
+	}
+
+	if got := PaletteSwatches(nil, size).Bounds(); !got.Empty() {
+		t.Errorf("empty palette Bounds() = %v, want empty", got)
+	}
+}
+
+func TestAverageColor(t *testing.T) {
+	// Create test image, red on the left half and blue on the right
+	width, height := 20, 10
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		region *Region
+		want   color.RGBA
+	}{
+		{"whole image", nil, color.RGBA{R: 128, B: 128, A: 255}},
+		{"left half", &Region{X: 0, Y: 0, Width: 10, Height: 10}, color.RGBA{R: 255, A: 255}},
+		{"straddling region", &Region{X: 5, Y: 0, Width: 20, Height: 5}, color.RGBA{R: 85, B: 170, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AverageColor(img, tt.region)
+			if absDiff(got.R, tt.want.R) > 1 || got.G != tt.want.G || absDiff(got.B, tt.want.B) > 1 || got.A != 255 {
+				t.Errorf("AverageColor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMosaic(t *testing.T) {
+	// Extract a palette from a keyframe of three colors
+	keyframe := image.NewRGBA(image.Rect(0, 0, 30, 10))
+	keyColors := []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 30; x++ {
+			keyframe.Set(x, y, keyColors[x/10])
+		}
+	}
+	opts := DefaultOptions()
+	opts.K = 3
+	palette := ExtractPalette(keyframe, opts)
+
+	// Apply it to a different frame with a gradient
+	frame := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			frame.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 12), B: 100, A: 255})
+		}
+	}
+	result := ApplyMosaic(frame, palette, opts)
+
+	inPalette := make(map[color.Color]bool)
+	for _, c := range palette {
+		inPalette[c] = true
+	}
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if got := result.At(x, y); !inPalette[got] {
+				t.Fatalf("pixel (%d,%d) = %v, want a palette color from %v", x, y, got, palette)
+			}
+		}
+	}
+
+	// Without centroids the frame is unchanged
+	unchanged := ApplyMosaic(frame, nil, opts)
+	if got, want := unchanged.At(7, 3), frame.At(7, 3); got != want {
+		t.Errorf("pixel without centroids = %v, want %v", got, want)
+	}
+}
+
+func TestNearestColor(t *testing.T) {
+	palette := []color.RGBA{
+		{A: 255},
+		{R: 255, G: 255, B: 255, A: 255},
+		{R: 200, A: 255},
+		{B: 200, A: 255},
+	}
+
+	tests := []struct {
+		name  string
+		query color.RGBA
+		want  int
+	}{
+		{"exact", color.RGBA{R: 200, A: 255}, 2},
+		{"dark", color.RGBA{R: 20, G: 20, B: 30, A: 255}, 0},
+		{"light", color.RGBA{R: 220, G: 230, B: 240, A: 255}, 1},
+		{"reddish", color.RGBA{R: 150, G: 40, B: 10, A: 255}, 2},
+		{"bluish", color.RGBA{R: 10, G: 40, B: 150}, 3},
+		{"tie", color.RGBA{R: 100, B: 100, A: 255}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, match := NearestColor(tt.query, palette)
+			if idx != tt.want || match != palette[tt.want] {
+				t.Errorf("NearestColor(%v) = %d, %v, want %d, %v", tt.query, idx, match, tt.want, palette[tt.want])
+			}
+		})
+	}
+
+	if idx, _ := NearestColor(color.RGBA{R: 1}, nil); idx != -1 {
+		t.Errorf("empty palette index = %d, want -1", idx)
+	}
+}
+
+func BenchmarkNearestColor(b *testing.B) {
+	palette := make([]color.RGBA, 16)
+	for i := range palette {
+		palette[i] = color.RGBA{R: uint8(i * 16), G: uint8(255 - i*16), B: uint8(i * 7), A: 255}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NearestColor(color.RGBA{R: uint8(i), G: uint8(i >> 8), B: uint8(i >> 16), A: 255}, palette)
+	}
+}
@@ -0,0 +1,80 @@
+package mosaic
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// Palette is a list of block colors, as used by MosaicOptions.Palette. It
+// marshals to JSON as an array of "#rrggbb" strings ("#rrggbbaa" for colors
+// that are not opaque), so a palette computed once can be saved and reused
+// as a fixed palette later.
+type Palette []color.RGBA
+
+// MarshalJSON encodes the palette as an array of hex color strings
+func (p Palette) MarshalJSON() ([]byte, error) {
+	hex := make([]string, len(p))
+	for i, c := range p {
+		hex[i] = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+		if c.A != 255 {
+			hex[i] += fmt.Sprintf("%02x", c.A)
+		}
+	}
+	return json.Marshal(hex)
+}
+
+// UnmarshalJSON decodes an array of "#rrggbb" or "#rrggbbaa" strings
+func (p *Palette) UnmarshalJSON(data []byte) error {
+	var hex []string
+	if err := json.Unmarshal(data, &hex); err != nil {
+		return err
+	}
+
+	palette := make(Palette, len(hex))
+	for i, s := range hex {
+		c, err := parseHexColor(s)
+		if err != nil {
+			return fmt.Errorf("palette color %d: %w", i, err)
+		}
+		palette[i] = c
+	}
+	*p = palette
+	return nil
+}
+
+// WritePalette writes the palette to w as JSON
+func WritePalette(w io.Writer, palette Palette) error {
+	if err := json.NewEncoder(w).Encode(palette); err != nil {
+		return fmt.Errorf("mosaic: writing palette: %w", err)
+	}
+	return nil
+}
+
+// ReadPalette reads a palette written by WritePalette from r, ready to be
+// set as MosaicOptions.Palette
+func ReadPalette(r io.Reader) (Palette, error) {
+	var palette Palette
+	if err := json.NewDecoder(r).Decode(&palette); err != nil {
+		return nil, fmt.Errorf("mosaic: reading palette: %w", err)
+	}
+	return palette, nil
+}
+
+// parseHexColor parses a "#rrggbb" or "#rrggbbaa" color
+func parseHexColor(s string) (color.RGBA, error) {
+	c := color.RGBA{A: 255}
+	var n int
+	var err error
+	switch len(s) {
+	case 7:
+		n, err = fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 9:
+		n, err = fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	}
+	if err != nil || n == 0 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, want #rrggbb or #rrggbbaa", s)
+	}
+	return c, nil
+}
@@ -0,0 +1,113 @@
+package mosaic
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPaletteJSON(t *testing.T) {
+	palette := Palette{{R: 255, A: 255}, {R: 0x12, G: 0x34, B: 0x56, A: 255}, {B: 255, A: 128}}
+
+	data, err := json.Marshal(palette)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if want := `["#ff0000","#123456","#0000ff80"]`; string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+
+	var got Palette
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, palette) {
+		t.Errorf("json.Unmarshal() = %v, want %v", got, palette)
+	}
+}
+
+func TestReadPaletteErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"Not JSON", "#ff0000"},
+		{"Not an array", `{"R": 255}`},
+		{"Missing hash", `["ff0000"]`},
+		{"Short color", `["#fff"]`},
+		{"Bad digits", `["#ff00zz"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadPalette(strings.NewReader(tt.input)); err == nil {
+				t.Error("ReadPalette() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestWritePaletteRoundTrip(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 8), B: uint8((x + y) * 3), A: 255})
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*MosaicOptions)
+	}{
+		{"default", func(o *MosaicOptions) {}},
+		{"adjusted colors", func(o *MosaicOptions) { o.SaturationScale, o.BrightnessScale = 1.5, 0.8 }},
+		{"linear gamma", func(o *MosaicOptions) { o.LinearizeGamma = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.InitMethod = InitPlusPlus
+			opts.Seed = 1
+			tt.modify(opts)
+
+			var saved bytes.Buffer
+			if err := WritePalette(&saved, ExtractPalette(img, opts)); err != nil {
+				t.Fatalf("WritePalette() error = %v", err)
+			}
+			loaded, err := ReadPalette(&saved)
+			if err != nil {
+				t.Fatalf("ReadPalette() error = %v", err)
+			}
+
+			// A reloaded palette paints exactly the same mosaic as the
+			// extracted one, using its colors as given
+			encode := func(palette Palette) []byte {
+				fixed := *opts
+				fixed.Palette = palette
+				result := CreateMosaic(img, &fixed)
+				for y := 0; y < 30; y++ {
+					for x := 0; x < 40; x++ {
+						if c := color.RGBAModel.Convert(result.At(x, y)).(color.RGBA); !slices.Contains(palette, c) {
+							t.Fatalf("pixel (%d, %d) = %v, not in palette %v", x, y, c, palette)
+						}
+					}
+				}
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, result); err != nil {
+					t.Fatalf("png.Encode() error = %v", err)
+				}
+				return buf.Bytes()
+			}
+			if !bytes.Equal(encode(loaded), encode(ExtractPalette(img, opts))) {
+				t.Error("mosaic with the reloaded palette differs from the original")
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package mosaic
+
+import (
+	"image"
+	"image/draw"
+)
+
+// CreatePhotoMosaic builds the mosaic from small photos: each block is
+// replaced by the tile whose average color is nearest to the block's average,
+// scaled to the block. Without tiles it falls back to CreateMosaic.
+func CreatePhotoMosaic(img image.Image, tiles []image.Image, opts *MosaicOptions) image.Image {
+	if len(tiles) == 0 {
+		return CreateMosaic(img, opts)
+	}
+	opts = opts.Normalize()
+	opts = opts.withInvertedRegions()
+
+	bounds := img.Bounds()
+	mosaic := newOutputImage(img, opts)
+	draw.Draw(mosaic, bounds, img, bounds.Min, draw.Src)
+
+	// Average every tile in the same color space as the blocks
+	averages := make([]Pixel, len(tiles))
+	for i, tile := range tiles {
+		tb := tile.Bounds()
+		pixels := imageToPixels(tile, &Region{X: tb.Min.X, Y: tb.Min.Y, Width: tb.Dx(), Height: tb.Dy()})
+		for j, p := range pixels {
+			pixels[j] = opts.convertPixel(p)
+		}
+		averages[i] = averagePixels(pixels)
+	}
+
+	dist := opts.distanceFunc()
+	for _, region := range opts.regions(bounds) {
+		for _, rect := range regionBlocks(img, region, opts) {
+			blockPixels := opts.readPixels(img, blockRegion(region, rect))
+			if len(blockPixels) == 0 {
+				continue
+			}
+			tile := tiles[findNearestCentroidIndex(averagePixels(blockPixels), averages, dist)]
+			drawScaled(mosaic, rect, rect.Intersect(region.rect()), tile)
+		}
+	}
+
+	// Restore preserved boxes from the original image
+	for _, box := range opts.PreserveBoxes {
+		draw.Draw(mosaic, box.Intersect(bounds), img, box.Intersect(bounds).Min, draw.Src)
+	}
+
+	return mosaic
+}
+
+// drawScaled draws src scaled (nearest neighbor) to fill rect, painting
+// only the part of rect within clip
+func drawScaled(dst draw.Image, rect, clip image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if sb.Empty() || rect.Empty() {
+		return
+	}
+
+	clip = clip.Intersect(rect).Intersect(dst.Bounds())
+	for y := clip.Min.Y; y < clip.Max.Y; y++ {
+		sy := sb.Min.Y + (y-rect.Min.Y)*sb.Dy()/rect.Dy()
+		for x := clip.Min.X; x < clip.Max.X; x++ {
+			sx := sb.Min.X + (x-rect.Min.X)*sb.Dx()/rect.Dx()
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+}
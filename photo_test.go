@@ -0,0 +1,61 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestCreatePhotoMosaic(t *testing.T) {
+	// newTile creates a small solid-color tile
+	newTile := func(c color.RGBA) image.Image {
+		tile := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		draw.Draw(tile, tile.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		return tile
+	}
+
+	red := color.RGBA{R: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	tiles := []image.Image{newTile(red), newTile(green), newTile(blue)}
+
+	// Create test image with dark red, light green and navy stripes
+	width, height := 30, 10
+	stripes := []color.RGBA{
+		{R: 180, G: 30, B: 20, A: 255},
+		{R: 100, G: 220, B: 90, A: 255},
+		{R: 10, G: 20, B: 120, A: 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, stripes[x/10])
+		}
+	}
+
+	result := CreatePhotoMosaic(img, tiles, DefaultOptions())
+
+	want := []color.RGBA{red, green, blue}
+	for i, c := range want {
+		for y := 0; y < height; y++ {
+			for x := i * 10; x < (i+1)*10; x++ {
+				if got := result.At(x, y); got != c {
+					t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, c)
+				}
+			}
+		}
+	}
+}
+
+func TestCreatePhotoMosaicNoTiles(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	img.Set(3, 3, color.RGBA{R: 255, A: 255})
+
+	result := CreatePhotoMosaic(img, nil, DefaultOptions())
+
+	// Falls back to the solid-color mosaic
+	if got, want := result.At(3, 3), CreateMosaic(img, DefaultOptions()).At(3, 3); got != want {
+		t.Errorf("pixel = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,31 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// posterizeRegion paints every pixel of the region with the centroid nearest
+// to its own color, without any blocks, and marks the centroids it uses
+func posterizeRegion(mosaic draw.Image, img image.Image, region *Region, centroids []Pixel, used []bool, dist distanceFunc, opts *MosaicOptions) {
+	colors := make([]color.Color, len(centroids))
+	for i, c := range centroids {
+		colors[i] = outputColor(mosaic, opts.outputPixel(c))
+	}
+
+	nearest := opts.nearestCentroidFunc(centroids, dist)
+	cache := newCentroidCache(opts.CentroidCacheBits)
+	transparent := opts.transparentMask(img)
+	pixelAt := pixelReader(img)
+	for y := region.Y; y < region.Y+region.Height; y++ {
+		for x := region.X; x < region.X+region.Width; x++ {
+			if inAnyRect(x, y, opts.PreserveBoxes) || !region.contains(x, y) || (transparent != nil && transparent(x, y)) {
+				continue
+			}
+			idx := cache.nearestIndex(opts.convertPixel(pixelAt(x, y)), nearest)
+			used[idx] = true
+			mosaic.Set(x, y, colors[idx])
+		}
+	}
+}
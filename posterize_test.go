@@ -0,0 +1,55 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPosterize(t *testing.T) {
+	// A smooth diagonal gradient
+	width, height := 40, 30
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 8), B: uint8((x + y) * 3), A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 4
+	opts.InitMethod = InitFixedSampling
+	opts.Posterize = true
+
+	result, stats := CreateMosaicWithStats(img, opts)
+	if len(stats.Palette) != opts.K {
+		t.Fatalf("palette = %v, want %d colors", stats.Palette, opts.K)
+	}
+	inPalette := make(map[color.RGBA]bool)
+	for _, c := range stats.Palette {
+		inPalette[c] = true
+	}
+
+	// Every pixel is a palette color, and colors change within blocks
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got := result.At(x, y).(color.RGBA); !inPalette[got] {
+				t.Fatalf("pixel (%d,%d) = %v, want one of %v", x, y, got, stats.Palette)
+			}
+		}
+	}
+	mixed := 0
+	for by := 0; by < height; by += opts.BlockSize {
+		for bx := 0; bx < width; bx += opts.BlockSize {
+			for y := by; y < by+opts.BlockSize; y++ {
+				if result.At(bx+opts.BlockSize-1, y) != result.At(bx, by) {
+					mixed++
+					break
+				}
+			}
+		}
+	}
+	if mixed == 0 {
+		t.Errorf("every %d×%d block is uniform, want per-pixel colors", opts.BlockSize, opts.BlockSize)
+	}
+}
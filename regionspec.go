@@ -0,0 +1,58 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// RegionSpec is a region with its own mosaic settings. Zero fields use the
+// settings of the MosaicOptions it belongs to.
+type RegionSpec struct {
+	Region    *Region      // area to apply the mosaic effect to (nil for entire image; Invert is ignored)
+	K         int          // number of colors for k-means
+	BlockSize int          // size of mosaic blocks, overriding BlockWidth and BlockHeight
+	Palette   []color.RGBA // fixed block colors to use instead of clustering
+}
+
+// specOptions returns the options for painting a single RegionSpec
+func (opts *MosaicOptions) specOptions(spec RegionSpec) *MosaicOptions {
+	o := *opts
+	o.Region, o.Regions, o.RegionSpecs = spec.Region, nil, nil
+	if spec.K > 0 {
+		o.K = spec.K
+	}
+	if spec.BlockSize > 0 {
+		o.BlockSize, o.BlockWidth, o.BlockHeight = spec.BlockSize, 0, 0
+	}
+	if len(spec.Palette) > 0 {
+		o.Palette = spec.Palette
+	}
+	return &o
+}
+
+// paintSpecs clusters and paints each RegionSpec independently, in order,
+// and merges their stats. With CollapseBlocks only the first spec is painted,
+// and its collapsed image is returned.
+func paintSpecs(mosaic draw.Image, img image.Image, regions []*Region, opts *MosaicOptions) (*image.RGBA, *MosaicStats) {
+	stats := &MosaicStats{Converged: true}
+	for i, region := range regions {
+		collapsed, s := paintMosaic(mosaic, img, []*Region{region}, opts.specOptions(opts.RegionSpecs[i]))
+		if collapsed != nil {
+			return collapsed, s
+		}
+		stats.merge(s)
+	}
+	return nil, stats
+}
+
+// merge adds the stats of another clustering: iterations and movement are
+// the largest of both, and palettes and cluster sizes are concatenated
+func (s *MosaicStats) merge(o *MosaicStats) {
+	s.IterationsRun = max(s.IterationsRun, o.IterationsRun)
+	s.Converged = s.Converged && (o.Converged || o.IterationsRun == 0)
+	s.FinalMaxDiff = max(s.FinalMaxDiff, o.FinalMaxDiff)
+	s.ClusterSizes = append(s.ClusterSizes, o.ClusterSizes...)
+	s.Palette = append(s.Palette, o.Palette...)
+	s.ColorsUsed += o.ColorsUsed
+}
@@ -0,0 +1,79 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRegionSpecs(t *testing.T) {
+	// Create a diagonal gradient
+	img := image.NewRGBA(image.Rect(0, 0, 80, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 80; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 3), G: uint8(y * 6), B: 100, A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.InitMethod = InitFixedSampling
+	opts.RegionSpecs = []RegionSpec{
+		{Region: &Region{X: 0, Y: 0, Width: 40, Height: 40}, K: 2, BlockSize: 10},
+		{Region: &Region{X: 40, Y: 0, Width: 40, Height: 40}, K: 16, BlockSize: 4},
+	}
+
+	result, stats := CreateMosaicWithStats(img, opts)
+
+	// uniform reports whether every pixel of rect has the same color
+	uniform := func(rect image.Rectangle) bool {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if result.At(x, y) != result.At(rect.Min.X, rect.Min.Y) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	distinct := func(rect image.Rectangle) int {
+		colors := make(map[color.Color]bool)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				colors[result.At(x, y)] = true
+			}
+		}
+		return len(colors)
+	}
+
+	// The left spec has 10px blocks of at most 2 colors
+	for y := 0; y < 40; y += 10 {
+		for x := 0; x < 40; x += 10 {
+			if block := image.Rect(x, y, x+10, y+10); !uniform(block) {
+				t.Errorf("left block %v is not uniform", block)
+			}
+		}
+	}
+	if got := distinct(image.Rect(0, 0, 40, 40)); got > 2 {
+		t.Errorf("left spec has %d colors, want at most 2", got)
+	}
+
+	// The right spec has 4px blocks, so 10px cells are not uniform
+	for y := 0; y < 40; y += 4 {
+		for x := 40; x < 80; x += 4 {
+			if block := image.Rect(x, y, x+4, y+4); !uniform(block) {
+				t.Errorf("right block %v is not uniform", block)
+			}
+		}
+	}
+	if uniform(image.Rect(40, 0, 50, 10)) {
+		t.Errorf("right spec painted a uniform 10px cell, want 4px blocks")
+	}
+	if got := distinct(image.Rect(40, 0, 80, 40)); got <= 2 {
+		t.Errorf("right spec has %d colors, want more than 2", got)
+	}
+
+	// Stats cover both clusterings
+	if len(stats.Palette) != 2+16 {
+		t.Errorf("palette has %d colors, want %d", len(stats.Palette), 2+16)
+	}
+}
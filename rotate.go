@@ -0,0 +1,118 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// boundingBox returns the smallest axis-aligned region containing the
+// rotated region
+func (r *Region) boundingBox() *Region {
+	cos, sin := math.Cos(r.Angle), math.Sin(r.Angle)
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{0, 0}, {float64(r.Width), 0}, {0, float64(r.Height)}, {float64(r.Width), float64(r.Height)}} {
+		x := float64(r.X) + corner[0]*cos - corner[1]*sin
+		y := float64(r.Y) + corner[0]*sin + corner[1]*cos
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+
+	x0, y0 := int(math.Floor(minX)), int(math.Floor(minY))
+	return &Region{
+		X:      x0,
+		Y:      y0,
+		Width:  int(math.Ceil(maxX)) - x0,
+		Height: int(math.Ceil(maxY)) - y0,
+	}
+}
+
+// contains reports whether the pixel (x, y) belongs to a resolved region.
+// Only rotated and elliptical regions exclude pixels within their bounding
+// box.
+func (r *Region) contains(x, y int) bool {
+	if r.mask == nil {
+		return true
+	}
+	return r.mask.inMask(x, y)
+}
+
+// inMask reports whether the center of the pixel (x, y) lies in the rotated
+// rectangle, or the ellipse inscribed in it for ShapeEllipse
+func (r *Region) inMask(x, y int) bool {
+	u, v := r.localPoint(x, y)
+	if r.Shape == ShapeEllipse {
+		rx, ry := float64(r.Width)/2, float64(r.Height)/2
+		u, v = (u-rx)/rx, (v-ry)/ry
+		return u*u+v*v <= 1
+	}
+	return u >= 0 && u < float64(r.Width) && v >= 0 && v < float64(r.Height)
+}
+
+// localPoint returns the center of the pixel (x, y) in the frame of the
+// region's unrotated rectangle, with its top-left corner at the origin
+func (r *Region) localPoint(x, y int) (u, v float64) {
+	dx := float64(x) + 0.5 - float64(r.X)
+	dy := float64(y) + 0.5 - float64(r.Y)
+	cos, sin := math.Cos(r.Angle), math.Sin(r.Angle)
+	return dx*cos + dy*sin, -dx*sin + dy*cos
+}
+
+// edgeDistance returns how far the center of the pixel (x, y) of a resolved
+// region lies inside its border, ignoring borders of a rectangular region on
+// the edge of bounds, where there is no original image beyond to fade into.
+// Distances in an ellipse are measured along its radius, scaled to the
+// shorter semi-axis.
+func (r *Region) edgeDistance(x, y int, bounds image.Rectangle) float64 {
+	if r.mask != nil {
+		m := r.mask
+		u, v := m.localPoint(x, y)
+		if m.Shape == ShapeEllipse {
+			rx, ry := float64(m.Width)/2, float64(m.Height)/2
+			return (1 - math.Hypot((u-rx)/rx, (v-ry)/ry)) * min(rx, ry)
+		}
+		return min(u, float64(m.Width)-u, v, float64(m.Height)-v)
+	}
+
+	px, py := float64(x)+0.5, float64(y)+0.5
+	d := math.Inf(1)
+	if r.X > bounds.Min.X {
+		d = min(d, px-float64(r.X))
+	}
+	if r.X+r.Width < bounds.Max.X {
+		d = min(d, float64(r.X+r.Width)-px)
+	}
+	if r.Y > bounds.Min.Y {
+		d = min(d, py-float64(r.Y))
+	}
+	if r.Y+r.Height < bounds.Max.Y {
+		d = min(d, float64(r.Y+r.Height)-py)
+	}
+	return d
+}
+
+// target returns the image to paint a resolved region into: img itself, or
+// for rotated and elliptical regions a view of img that ignores pixels
+// outside the region's shape
+func (r *Region) target(img draw.Image) draw.Image {
+	if r.mask == nil {
+		return img
+	}
+	return &maskedImage{Image: img, region: r.mask}
+}
+
+// maskedImage is a draw.Image that only sets pixels within a rotated or
+// elliptical region
+type maskedImage struct {
+	draw.Image
+	region *Region
+}
+
+// Set sets the pixel at (x, y) when it lies within the region
+func (m *maskedImage) Set(x, y int, c color.Color) {
+	if m.region.inMask(x, y) {
+		m.Image.Set(x, y, c)
+	}
+}
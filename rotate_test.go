@@ -0,0 +1,104 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestCreateMosaicRotatedRegion(t *testing.T) {
+	// Create test image with a gradient so that mosaicked pixels change
+	width, height := 60, 50
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8((x + y) * 2), A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.Region = &Region{X: 20, Y: 10, Width: 20, Height: 10, Angle: math.Pi / 4}
+
+	result := CreateMosaic(img, opts)
+
+	// (25,10) is within the bounding box but just outside the rotated
+	// rectangle, above its top edge
+	if got, want := result.At(25, 10), img.At(25, 10); got != want {
+		t.Errorf("outside pixel (25,10) = %v, want original %v", got, want)
+	}
+
+	// (23,20) is the rotated rectangle's local point (10, 5)
+	if got, orig := result.At(23, 20), img.At(23, 20); got == orig {
+		t.Errorf("inside pixel (23,20) = %v, want it mosaicked", got)
+	}
+}
+
+func TestRegionBoundingBox(t *testing.T) {
+	r := &Region{X: 10, Y: 10, Width: 10, Height: 10, Angle: math.Pi / 2}
+
+	// A quarter turn clockwise about the top-left swings the square to its left
+	want := Region{X: 0, Y: 10, Width: 10, Height: 10}
+	if got := r.boundingBox(); *got != want {
+		t.Errorf("boundingBox() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestCreateMosaicEllipseRegion(t *testing.T) {
+	// Create test image with a gradient so that mosaicked pixels change
+	width, height := 60, 50
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8((x + y) * 2), A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 2
+	opts.BlockSize = 5
+	opts.Region = &Region{X: 10, Y: 10, Width: 40, Height: 30, Shape: ShapeEllipse}
+
+	result := CreateMosaic(img, opts)
+
+	// The corners of the bounding rectangle lie outside the ellipse
+	for _, p := range []image.Point{{10, 10}, {49, 10}, {10, 39}, {49, 39}} {
+		if got, want := result.At(p.X, p.Y), img.At(p.X, p.Y); got != want {
+			t.Errorf("corner pixel %v = %v, want original %v", p, got, want)
+		}
+	}
+	if got, orig := result.At(31, 26), img.At(31, 26); got == orig {
+		t.Errorf("center pixel (31,26) = %v, want it mosaicked", got)
+	}
+}
+
+func TestEllipseRegionBlockColor(t *testing.T) {
+	// A red disc in a blue square, mosaicked as a single block
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	region := &Region{X: 0, Y: 0, Width: 20, Height: 20, Shape: ShapeEllipse}
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			if region.inMask(x, y) {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.BlockSize = 20
+	opts.NoQuantize = true
+	opts.Region = region
+
+	// Only pixels inside the ellipse contribute to the block color
+	result := CreateMosaic(img, opts)
+	if got := result.At(10, 10); got != red {
+		t.Errorf("block color = %v, want %v", got, red)
+	}
+	if got := result.At(0, 0); got != blue {
+		t.Errorf("corner pixel = %v, want %v", got, blue)
+	}
+}
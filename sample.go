@@ -0,0 +1,95 @@
+package mosaic
+
+import (
+	"image"
+	"sort"
+)
+
+// BlockSample selects how a block's representative color is derived from its
+// pixels before it is matched to a palette color
+type BlockSample int
+
+const (
+	SampleAverage       BlockSample = iota // mean of the block's pixels
+	SampleCenter                           // the pixel at the block's spatial center
+	SampleMedian                           // component-wise median of the block's pixels
+	SampleMostSaturated                    // the block's pixel with the highest HSV saturation
+)
+
+// sampleBlock reduces the pixels of a block of img, as read by appendPixels,
+// to the color that represents the block
+func (opts *MosaicOptions) sampleBlock(img image.Image, block *Region, pixels []Pixel) Pixel {
+	switch {
+	case len(pixels) == 0:
+		return Pixel{}
+	case opts.BlockSample == SampleCenter:
+		return opts.centerPixel(img, block)
+	case opts.BlockSample == SampleMedian:
+		return medianPixel(pixels)
+	case opts.BlockSample == SampleMostSaturated:
+		return mostSaturatedPixel(pixels)
+	default:
+		return averagePixels(pixels)
+	}
+}
+
+// centerPixel returns the pixel at the center of a block, rounding down to
+// the right and bottom of even sizes. When the center pixel is masked out,
+// preserved or transparent, the nearest pixel appendPixels would read is
+// used instead, the first one in scan order on ties.
+func (opts *MosaicOptions) centerPixel(img image.Image, block *Region) Pixel {
+	transparent := opts.transparentMask(img)
+	included := func(x, y int) bool {
+		return !inAnyRect(x, y, opts.PreserveBoxes) && block.contains(x, y) && (transparent == nil || !transparent(x, y))
+	}
+
+	cx, cy := block.X+block.Width/2, block.Y+block.Height/2
+	best, bestDist := image.Pt(cx, cy), -1
+	if !included(cx, cy) {
+		for y := block.Y; y < block.Y+block.Height; y++ {
+			for x := block.X; x < block.X+block.Width; x++ {
+				d := (x-cx)*(x-cx) + (y-cy)*(y-cy)
+				if included(x, y) && (bestDist < 0 || d < bestDist) {
+					best, bestDist = image.Pt(x, y), d
+				}
+			}
+		}
+	}
+	return opts.convertPixel(pixelReader(img)(best.X, best.Y))
+}
+
+// medianPixel returns the component-wise median of a non-empty slice of
+// pixels, averaging the middle two values of even-length slices
+func medianPixel(pixels []Pixel) Pixel {
+	channels := [3][]float64{}
+	for c := range channels {
+		channels[c] = make([]float64, len(pixels))
+	}
+	for i, p := range pixels {
+		channels[0][i], channels[1][i], channels[2][i] = p.R, p.G, p.B
+	}
+
+	var median [3]float64
+	n := len(pixels)
+	for c, values := range channels {
+		sort.Float64s(values)
+		median[c] = values[n/2]
+		if n%2 == 0 {
+			median[c] = (values[n/2-1] + values[n/2]) / 2
+		}
+	}
+
+	return Pixel{R: median[0], G: median[1], B: median[2]}
+}
+
+// mostSaturatedPixel returns the pixel of a non-empty slice with the highest
+// HSV saturation, the first one in scan order on ties
+func mostSaturatedPixel(pixels []Pixel) Pixel {
+	best, bestSat := pixels[0], -1.0
+	for _, p := range pixels {
+		if _, s, _ := pixelToHSV(p); s > bestSat {
+			best, bestSat = p, s
+		}
+	}
+	return best
+}
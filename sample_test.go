@@ -0,0 +1,156 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// sampleImage returns a width×height image filled with c and the region
+// covering it
+func sampleImage(width, height int, c color.RGBA) (*image.RGBA, *Region) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img, &Region{X: 0, Y: 0, Width: width, Height: height}
+}
+
+func TestSampleBlock(t *testing.T) {
+	// A 5x5 gray block with one white outlier in the corner
+	img, block := sampleImage(5, 5, color.RGBA{R: 128, G: 128, B: 128, A: 255})
+	img.SetRGBA(0, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	gray := Pixel{R: 128.0 / 255, G: 128.0 / 255, B: 128.0 / 255}
+	average := (24*gray.R + 1) / 25
+
+	tests := []struct {
+		name   string
+		sample BlockSample
+		want   Pixel
+	}{
+		{"average is pulled toward the outlier", SampleAverage, Pixel{R: average, G: average, B: average}},
+		{"center", SampleCenter, gray},
+		{"median ignores the outlier", SampleMedian, gray},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.BlockSample = tt.sample
+			got := opts.sampleBlock(img, block, opts.appendPixels(nil, img, block))
+			if distance(got, tt.want) > 1e-9 {
+				t.Errorf("sampleBlock() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleCenter(t *testing.T) {
+	// A gray image with a red left column and a blue pixel just above the
+	// center of the 10x10 block, first in scan order among its neighbors
+	gray := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	img, _ := sampleImage(15, 10, gray)
+	for y := 0; y < 10; y++ {
+		img.SetRGBA(0, y, color.RGBA{R: 255, A: 255})
+	}
+	img.SetRGBA(5, 4, color.RGBA{B: 255, A: 255})
+	img.SetRGBA(12, 5, color.RGBA{G: 255, A: 255})
+
+	tests := []struct {
+		name     string
+		block    *Region
+		preserve []image.Rectangle
+		want     color.RGBA
+	}{
+		{"even block", &Region{X: 0, Y: 0, Width: 10, Height: 10}, nil, gray},
+		{"clipped edge block", &Region{X: 10, Y: 0, Width: 5, Height: 10}, nil, color.RGBA{G: 255, A: 255}},
+		{"masked center uses the nearest pixel", &Region{X: 0, Y: 0, Width: 10, Height: 10}, []image.Rectangle{image.Rect(5, 5, 6, 6)}, color.RGBA{B: 255, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.BlockSample = SampleCenter
+			opts.PreserveBoxes = tt.preserve
+			got := opts.sampleBlock(img, tt.block, opts.appendPixels(nil, img, tt.block))
+			if got.ToRGBA() != tt.want {
+				t.Errorf("sampleBlock() = %v, want %v", got.ToRGBA(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleMostSaturated(t *testing.T) {
+	// A 4x4 block of grays with one vivid red pixel
+	img, block := sampleImage(4, 4, color.RGBA{})
+	for i := 0; i < 16; i++ {
+		v := uint8(50 + i*10)
+		img.SetRGBA(i%4, i/4, color.RGBA{R: v, G: v, B: v, A: 255})
+	}
+	red := color.RGBA{R: 230, G: 25, B: 25, A: 255}
+	img.SetRGBA(1, 2, red)
+	img.SetRGBA(3, 0, color.RGBA{R: 150, G: 128, B: 128, A: 255}) // slightly tinted
+
+	opts := DefaultOptions()
+	opts.BlockSample = SampleMostSaturated
+	if got := opts.sampleBlock(img, block, opts.appendPixels(nil, img, block)); got.ToRGBA() != red {
+		t.Errorf("sampleBlock() = %v, want %v", got.ToRGBA(), red)
+	}
+}
+
+func TestMedianPixel(t *testing.T) {
+	tests := []struct {
+		name   string
+		pixels []Pixel
+		want   Pixel
+	}{
+		{"odd", []Pixel{{R: 0.9, G: 0.1}, {R: 0.1, G: 0.5}, {R: 0.5, G: 0.9}}, Pixel{R: 0.5, G: 0.5}},
+		{"even", []Pixel{{B: 0.2}, {B: 0.4}, {B: 1}, {B: 0}}, Pixel{B: 0.3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := medianPixel(tt.pixels); distance(got, tt.want) > 1e-9 {
+				t.Errorf("medianPixel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateMosaicBlockSample(t *testing.T) {
+	// Create a gray image with a white outlier in the corner of each block
+	width, height := 20, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	gray := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x%10 == 0 && y%10 == 0 {
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			} else {
+				img.Set(x, y, gray)
+			}
+		}
+	}
+
+	tests := []struct {
+		sample    BlockSample
+		wantExact bool
+	}{
+		{SampleAverage, false},
+		{SampleCenter, true},
+		{SampleMedian, true},
+	}
+
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.NoQuantize = true
+		opts.BlockSample = tt.sample
+
+		result := CreateMosaic(img, opts)
+		if got := result.At(5, 5) == gray; got != tt.wantExact {
+			t.Errorf("BlockSample %d: block color = %v, want exact gray %v", tt.sample, result.At(5, 5), tt.wantExact)
+		}
+	}
+}
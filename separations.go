@@ -0,0 +1,56 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// ColorSeparations creates one image per palette color in use, e.g. for
+// screen-printing. Each separation shows only the blocks assigned to its
+// color, painted in that color on a transparent background. The colors are
+// returned in the same order as the separations.
+func ColorSeparations(img image.Image, opts *MosaicOptions) ([]image.Image, []color.RGBA) {
+	opts = opts.Normalize()
+	opts = opts.withInvertedRegions()
+
+	bounds := img.Bounds()
+	regions := opts.regions(bounds)
+	dist := opts.distanceFunc()
+	centroids, _ := clusterRegions(img, regions, opts)
+	if len(centroids) == 0 {
+		return nil, nil
+	}
+
+	// Paint each block into the separation of its centroid
+	layers := make(map[int]*image.RGBA)
+	for _, region := range regions {
+		rects := regionBlocks(img, region, opts)
+		for _, block := range planRegion(img, region, rects, centroids, dist, opts, nil) {
+			if block.index < 0 {
+				continue
+			}
+			layer, ok := layers[block.index]
+			if !ok {
+				layer = image.NewRGBA(bounds)
+				layers[block.index] = layer
+			}
+			paintBlock(layer, block.rect, region.rect(), opts.BlockShape, block.color.ToRGBA())
+		}
+	}
+
+	indices := make([]int, 0, len(layers))
+	for i := range layers {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	separations := make([]image.Image, len(indices))
+	colors := make([]color.RGBA, len(indices))
+	for i, idx := range indices {
+		separations[i] = layers[idx]
+		colors[i] = opts.outputPixel(centroids[idx]).ToRGBA()
+	}
+
+	return separations, colors
+}
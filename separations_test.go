@@ -0,0 +1,48 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestColorSeparations(t *testing.T) {
+	// Create test image with three vertical bands aligned to the block grid
+	width, height := 30, 10
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	bands := []color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{B: 255, A: 255},
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, bands[x/10])
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 5
+
+	separations, colors := ColorSeparations(img, opts)
+
+	if len(separations) != len(bands) || len(colors) != len(bands) {
+		t.Fatalf("ColorSeparations() returned %d separations and %d colors, want %d",
+			len(separations), len(colors), len(bands))
+	}
+
+	for i, sep := range separations {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				c := sep.At(x, y).(color.RGBA)
+				inBlock := bands[x/10] == colors[i]
+				switch {
+				case inBlock && c != colors[i]:
+					t.Fatalf("separation %d pixel (%d,%d) = %v, want %v", i, x, y, c, colors[i])
+				case !inBlock && c.A != 0:
+					t.Fatalf("separation %d pixel (%d,%d) = %v, want transparent", i, x, y, c)
+				}
+			}
+		}
+	}
+}
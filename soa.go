@@ -0,0 +1,176 @@
+package mosaic
+
+import (
+	"math"
+	"sync"
+)
+
+// soaThreshold is the pixel count from which k-means runs on the
+// struct-of-arrays layout, where its cache-friendlier loops pay off
+const soaThreshold = 1 << 16
+
+// pixelPlanes holds pixels as separate R, G and B planes (struct of arrays)
+// so that the clustering loops walk contiguous float64 slices
+type pixelPlanes struct {
+	r, g, b []float64
+}
+
+// newPixelPlanes splits pixels into channel planes
+func newPixelPlanes(pixels []Pixel) *pixelPlanes {
+	planes := &pixelPlanes{
+		r: make([]float64, len(pixels)),
+		g: make([]float64, len(pixels)),
+		b: make([]float64, len(pixels)),
+	}
+	planes.fill(pixels)
+	return planes
+}
+
+// fill copies pixels into planes of the same length
+func (pp *pixelPlanes) fill(pixels []Pixel) {
+	for i, p := range pixels {
+		pp.r[i] = p.R
+		pp.g[i] = p.G
+		pp.b[i] = p.B
+	}
+}
+
+// at returns the pixel at index i
+func (pp *pixelPlanes) at(i int) Pixel {
+	return Pixel{R: pp.r[i], G: pp.g[i], B: pp.b[i]}
+}
+
+// refineCentroidsPlanes runs the same k-means iterations as refineCentroids
+// on channel planes, producing identical centroids and stats. With Workers,
+// the assignment step is split across goroutines, which only changes the
+// order cluster sums are added in.
+func refineCentroidsPlanes(planes *pixelPlanes, centroids []Pixel, opts *MosaicOptions) ([]Pixel, *MosaicStats) {
+	k := len(centroids)
+	n := len(planes.r)
+	w := opts.DistanceWeights
+	if w == [3]float64{} {
+		w = [3]float64{1, 1, 1}
+	}
+
+	dists := opts.buffers.distances(n)
+	stats := &MosaicStats{}
+	initialDiff := 0.0 // largest centroid move of the first iteration
+
+	for iteration := 0; iteration < opts.Iterations; iteration++ {
+		// Assign pixels to clusters
+		var tree *kdTree
+		if k >= kdTreeThreshold {
+			tree = newKDTree(centroids, w, opts.distanceFunc())
+		}
+		sums, sizes := planes.assign(centroids, w, tree, dists, opts.Workers)
+
+		// Update centroids
+		newCentroids := make([]Pixel, k)
+		maxDiff := 0.0
+
+		for i := range centroids {
+			if sizes[i] > 0 {
+				m := float64(sizes[i])
+				newCentroids[i] = Pixel{R: sums[i].R / m, G: sums[i].G / m, B: sums[i].B / m}
+			} else {
+				// Reseed empty clusters with the pixel farthest from its centroid
+				newCentroids[i] = centroids[i]
+				if far := farthestPixelIndex(dists); far >= 0 {
+					newCentroids[i] = planes.at(far)
+					dists[far] = 0
+				}
+			}
+
+			diff := distance(centroids[i], newCentroids[i])
+			if diff > maxDiff {
+				maxDiff = diff
+			}
+		}
+
+		centroids = newCentroids
+
+		stats.IterationsRun = iteration + 1
+		if opts.IterationFunc != nil {
+			opts.IterationFunc(iteration+1, centroids)
+		}
+		stats.FinalMaxDiff = maxDiff
+		if iteration == 0 {
+			initialDiff = maxDiff
+		}
+		stats.ClusterSizes = sizes
+
+		// Check for convergence
+		if opts.converged(stats.IterationsRun, maxDiff, initialDiff) {
+			stats.Converged = true
+			break
+		}
+	}
+
+	return centroids, stats
+}
+
+// assign assigns every pixel to its nearest centroid, recording the squared
+// distances in dists, and returns the sum and size of each cluster. With
+// more than one worker the pixels are split into contiguous shards, each
+// accumulated separately and merged in shard order.
+func (pp *pixelPlanes) assign(centroids []Pixel, w [3]float64, tree *kdTree, dists []float64, workers int) ([]Pixel, []int) {
+	k, n := len(centroids), len(pp.r)
+	workers = max(1, min(workers, n))
+	if workers == 1 {
+		sums, sizes := make([]Pixel, k), make([]int, k)
+		pp.assignRange(0, n, centroids, w, tree, dists, sums, sizes)
+		return sums, sizes
+	}
+
+	shardSums := make([][]Pixel, workers)
+	shardSizes := make([][]int, workers)
+
+	var wg sync.WaitGroup
+	for s := range workers {
+		shardSums[s], shardSizes[s] = make([]Pixel, k), make([]int, k)
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			pp.assignRange(lo, hi, centroids, w, tree, dists, shardSums[s], shardSizes[s])
+		}(n*s/workers, n*(s+1)/workers)
+	}
+	wg.Wait()
+
+	sums, sizes := shardSums[0], shardSizes[0]
+	for s := 1; s < workers; s++ {
+		for i := range sums {
+			sums[i].R += shardSums[s][i].R
+			sums[i].G += shardSums[s][i].G
+			sums[i].B += shardSums[s][i].B
+			sizes[i] += shardSizes[s][i]
+		}
+	}
+	return sums, sizes
+}
+
+// assignRange assigns the pixels in [lo, hi) to their nearest centroids,
+// accumulating the cluster sums in pixel order so that with a single range
+// the averages match averagePixels exactly
+func (pp *pixelPlanes) assignRange(lo, hi int, centroids []Pixel, w [3]float64, tree *kdTree, dists []float64, sums []Pixel, sizes []int) {
+	for j := lo; j < hi; j++ {
+		r, g, b := pp.r[j], pp.g[j], pp.b[j]
+		minDist := math.MaxFloat64
+		nearest := 0
+		if tree != nil {
+			nearest, minDist = tree.nearest(pp.at(j))
+		} else {
+			for i, c := range centroids {
+				dr, dg, db := r-c.R, g-c.G, b-c.B
+				if d := w[0]*dr*dr + w[1]*dg*dg + w[2]*db*db; d < minDist || (d == minDist && pixelLess(c, centroids[nearest])) {
+					minDist = d
+					nearest = i
+				}
+			}
+		}
+		dists[j] = minDist
+		sums[nearest].R += r
+		sums[nearest].G += g
+		sums[nearest].B += b
+		sizes[nearest]++
+	}
+}
@@ -0,0 +1,114 @@
+package mosaic
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// randomPixels returns n pixels with uniformly random channels
+func randomPixels(rng *rand.Rand, n int) []Pixel {
+	pixels := make([]Pixel, n)
+	for i := range pixels {
+		pixels[i] = Pixel{R: rng.Float64(), G: rng.Float64(), B: rng.Float64()}
+	}
+	return pixels
+}
+
+func TestRefineCentroidsPlanesMatches(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pixels := randomPixels(rng, 5000)
+
+	tests := []struct {
+		name      string
+		weights   [3]float64
+		duplicate bool // start half the centroids on the same pixel
+	}{
+		{"unweighted", [3]float64{1, 1, 1}, false},
+		{"weighted", [3]float64{1, 2, 1}, false},
+		{"empty clusters", [3]float64{1, 1, 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.DistanceWeights = tt.weights
+
+			init := make([]Pixel, opts.K)
+			copy(init, pixels[:opts.K])
+			if tt.duplicate {
+				// Duplicate centroids leave clusters empty and force reseeding
+				for i := opts.K / 2; i < opts.K; i++ {
+					init[i] = init[0]
+				}
+			}
+
+			want, wantStats := refineCentroids(pixels, append([]Pixel(nil), init...), opts)
+			got, gotStats := refineCentroidsPlanes(newPixelPlanes(pixels), append([]Pixel(nil), init...), opts)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("centroids = %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(gotStats, wantStats) {
+				t.Errorf("stats = %+v, want %+v", gotStats, wantStats)
+			}
+		})
+	}
+}
+
+func BenchmarkRefineCentroids(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	pixels := randomPixels(rng, 512*512)
+	init := pixels[:8]
+	opts := DefaultOptions()
+	opts.Iterations = 5
+
+	b.Run("AoS", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			refineCentroids(pixels, append([]Pixel(nil), init...), opts)
+		}
+	})
+	b.Run("SoA", func(b *testing.B) {
+		planes := newPixelPlanes(pixels)
+		for i := 0; i < b.N; i++ {
+			refineCentroidsPlanes(planes, append([]Pixel(nil), init...), opts)
+		}
+	})
+	b.Run("Workers", func(b *testing.B) {
+		planes := newPixelPlanes(pixels)
+		workers := *opts
+		workers.Workers = runtime.NumCPU()
+		for i := 0; i < b.N; i++ {
+			refineCentroidsPlanes(planes, append([]Pixel(nil), init...), &workers)
+		}
+	})
+}
+
+func TestRefineCentroidsPlanesWorkers(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pixels := randomPixels(rng, 20000)
+	planes := newPixelPlanes(pixels)
+
+	for _, k := range []int{8, kdTreeThreshold} {
+		opts := DefaultOptions()
+		opts.K = k
+		init := pixels[:k]
+
+		want, wantStats := refineCentroidsPlanes(planes, append([]Pixel(nil), init...), opts)
+		for _, workers := range []int{2, 3, 8} {
+			opts.Workers = workers
+			got, gotStats := refineCentroidsPlanes(planes, append([]Pixel(nil), init...), opts)
+
+			// Only the order cluster sums are added in differs
+			for i := range want {
+				if d := distance(got[i], want[i]); d > 1e-9 {
+					t.Errorf("K=%d, %d workers: centroid %d = %v, want %v", k, workers, i, got[i], want[i])
+				}
+			}
+			if gotStats.IterationsRun != wantStats.IterationsRun || !reflect.DeepEqual(gotStats.ClusterSizes, wantStats.ClusterSizes) {
+				t.Errorf("K=%d, %d workers: stats = %+v, want %+v", k, workers, gotStats, wantStats)
+			}
+		}
+	}
+}
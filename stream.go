@@ -0,0 +1,48 @@
+package mosaic
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// MosaicStream decodes an image from r, creates its mosaic and encodes the
+// result to w in the named format ("png", "jpeg" or "gif").
+func MosaicStream(r io.Reader, w io.Writer, format string, opts *MosaicOptions) error {
+	encode, err := encoderFor(format)
+	if err != nil {
+		return err
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return fmt.Errorf("mosaic: decoding image: %w", err)
+	}
+
+	if err := encode(w, CreateMosaic(img, opts)); err != nil {
+		return fmt.Errorf("mosaic: encoding %s image: %w", format, err)
+	}
+
+	return nil
+}
+
+// encoderFor returns the encoder for the named image format
+func encoderFor(format string) (func(io.Writer, image.Image) error, error) {
+	switch format {
+	case "png":
+		return png.Encode, nil
+	case "jpeg", "jpg":
+		return func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, nil)
+		}, nil
+	case "gif":
+		return func(w io.Writer, img image.Image) error {
+			return gif.Encode(w, img, nil)
+		}, nil
+	default:
+		return nil, fmt.Errorf("mosaic: unsupported format %q", format)
+	}
+}
@@ -0,0 +1,63 @@
+package mosaic
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestMosaicStream(t *testing.T) {
+	// Create and encode test image
+	width, height := 40, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 12), A: 255})
+		}
+	}
+
+	var in bytes.Buffer
+	if err := png.Encode(&in, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := MosaicStream(&in, &out, "png", DefaultOptions()); err != nil {
+		t.Fatalf("MosaicStream() error = %v", err)
+	}
+
+	result, format, err := image.Decode(&out)
+	if err != nil {
+		t.Fatalf("image.Decode() error = %v", err)
+	}
+	if format != "png" {
+		t.Errorf("output format = %q, want %q", format, "png")
+	}
+	if result.Bounds() != img.Bounds() {
+		t.Errorf("output bounds = %v, want %v", result.Bounds(), img.Bounds())
+	}
+}
+
+func TestMosaicStreamErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format string
+	}{
+		{"Unsupported format", "", "bmp"},
+		{"Invalid input", "not an image", "png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := MosaicStream(strings.NewReader(tt.input), &out, tt.format, nil)
+			if err == nil {
+				t.Error("MosaicStream() error = nil, want error")
+			}
+		})
+	}
+}
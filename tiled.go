@@ -0,0 +1,134 @@
+package mosaic
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// tileSamples is the largest number of pixels each tile contributes to the
+// palette clustered by ProcessTiled
+const tileSamples = 4096
+
+// TileSource reads parts of an image too large to decode at once
+type TileSource interface {
+	// Bounds returns the bounds of the whole image
+	Bounds() image.Rectangle
+	// ReadTile returns the pixels within bounds, which lie inside Bounds()
+	ReadTile(bounds image.Rectangle) (image.Image, error)
+}
+
+// TileSink receives the mosaicked tiles of ProcessTiled
+type TileSink interface {
+	// WriteTile stores the pixels of tile, whose bounds are its place in
+	// the whole image
+	WriteTile(tile image.Image) error
+}
+
+// ProcessTiled creates the mosaic of an image read from src in tiles of
+// tileSize×tileSize pixels and writes each mosaicked tile to dst, in scan
+// order, without holding the whole image in memory. Unless a fixed Palette
+// is set, one palette is first clustered from pixels sampled across all
+// tiles, so colors match between tiles. Each tile is read with the blocks
+// straddling its edges, so the block grid, GridLines included, is
+// continuous across seams.
+// Tiles follow the regular grid of Region, whose Angle, Shape and Invert
+// are ignored, as are Regions, RegionSpecs, DensityMap, CollapseBlocks,
+// BlockJitter and non-grid layouts. Dither and AutoKeyBackground apply per
+// tile.
+func ProcessTiled(src TileSource, dst TileSink, tileSize int, opts *MosaicOptions) error {
+	opts = opts.Normalize()
+	if tileSize <= 0 {
+		return fmt.Errorf("mosaic: tile size %d is not positive", tileSize)
+	}
+	grid := *opts
+	grid.Regions, grid.RegionSpecs = nil, nil
+	grid.BlockLayout = LayoutGrid
+	grid.DensityMap = nil
+	grid.CollapseBlocks = false
+	grid.BlockJitter = 0
+
+	bounds := src.Bounds()
+	region := resolveRegion(bounds, grid.Region)
+	grid.gridOrigin = &image.Point{X: region.X, Y: region.Y}
+
+	var tiles []image.Rectangle
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += tileSize {
+		for x := bounds.Min.X; x < bounds.Max.X; x += tileSize {
+			tiles = append(tiles, image.Rect(x, y, x+tileSize, y+tileSize).Intersect(bounds))
+		}
+	}
+
+	// Cluster one palette from pixels sampled in every tile
+	if len(grid.Palette) == 0 && len(grid.PositionRamp) == 0 && !grid.NoQuantize {
+		var samples []Pixel
+		for _, tile := range tiles {
+			rect := tile.Intersect(region.rect())
+			if rect.Empty() {
+				continue
+			}
+			img, err := src.ReadTile(rect)
+			if err != nil {
+				return fmt.Errorf("mosaic: reading tile %v: %w", rect, err)
+			}
+			pixels := grid.readPixels(img, &Region{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()})
+			samples = append(samples, samplePixels(pixels, float64(tileSamples)/float64(len(pixels)))...)
+		}
+		grid.centroids, _ = kmeans(samples, &grid)
+		if grid.centroids == nil {
+			// Nothing to cluster, so tiles are left as they are
+			grid.centroids = []Pixel{}
+		}
+	}
+
+	// Mosaic each tile together with the blocks that straddle its edges
+	for _, tile := range tiles {
+		read := tile
+		rect := blockAlignedRect(tile.Intersect(region.rect()), region, grid.blockDims(), grid.blockStride())
+		if !rect.Empty() {
+			read = read.Union(rect).Intersect(bounds)
+		}
+		img, err := src.ReadTile(read)
+		if err != nil {
+			return fmt.Errorf("mosaic: reading tile %v: %w", read, err)
+		}
+
+		tileOpts := grid
+		tileOpts.Region = &Region{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}
+		var mosaic image.Image = img
+		if !rect.Empty() {
+			mosaic = CreateMosaic(img, &tileOpts)
+		}
+
+		out := image.NewRGBA(tile)
+		draw.Draw(out, tile, mosaic, tile.Min, draw.Src)
+		if err := dst.WriteTile(out); err != nil {
+			return fmt.Errorf("mosaic: writing tile %v: %w", tile, err)
+		}
+	}
+
+	return nil
+}
+
+// blockAlignedRect returns the part of region covered by the blocks that
+// overlap rect, on the block grid laid out from the region's origin, or an
+// empty rectangle when rect is empty
+func blockAlignedRect(rect image.Rectangle, region *Region, dims, stride image.Point) image.Rectangle {
+	if rect.Empty() {
+		return image.Rectangle{}
+	}
+	// Blocks starting up to dims-stride before rect overlap it
+	first := image.Pt(
+		max(0, (rect.Min.X-region.X-(dims.X-stride.X))/stride.X),
+		max(0, (rect.Min.Y-region.Y-(dims.Y-stride.Y))/stride.Y),
+	)
+	last := image.Pt(
+		ceilDiv(rect.Max.X-region.X, stride.X),
+		ceilDiv(rect.Max.Y-region.Y, stride.Y),
+	)
+	aligned := image.Rect(
+		region.X+first.X*stride.X, region.Y+first.Y*stride.Y,
+		region.X+(last.X-1)*stride.X+dims.X, region.Y+(last.Y-1)*stride.Y+dims.Y,
+	)
+	return aligned.Intersect(region.rect())
+}
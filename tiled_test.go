@@ -0,0 +1,145 @@
+package mosaic
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// memorySource serves tiles of an in-memory image, recording the reads
+type memorySource struct {
+	img   *image.RGBA
+	reads []image.Rectangle
+}
+
+func (s *memorySource) Bounds() image.Rectangle { return s.img.Bounds() }
+
+func (s *memorySource) ReadTile(bounds image.Rectangle) (image.Image, error) {
+	s.reads = append(s.reads, bounds)
+	tile := image.NewRGBA(bounds)
+	draw.Draw(tile, bounds, s.img, bounds.Min, draw.Src)
+	return tile, nil
+}
+
+// memorySink assembles written tiles into one image
+type memorySink struct {
+	out   *image.RGBA
+	tiles []image.Rectangle
+}
+
+func (s *memorySink) WriteTile(tile image.Image) error {
+	s.tiles = append(s.tiles, tile.Bounds())
+	draw.Draw(s.out, tile.Bounds(), tile, tile.Bounds().Min, draw.Src)
+	return nil
+}
+
+// failingSink rejects every tile
+type failingSink struct{}
+
+func (failingSink) WriteTile(image.Image) error { return errors.New("disk full") }
+
+func TestProcessTiled(t *testing.T) {
+	// Create a 40x40 image, split into four 20x20 tiles that 7px blocks
+	// do not divide evenly and 5px blocks do
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 6), B: uint8((x * y) % 200), A: 255})
+		}
+	}
+
+	tests := []struct {
+		name      string
+		region    *Region
+		blockSize int
+		stride    int
+		gridLines bool
+	}{
+		{"whole image", nil, 7, 0, false},
+		{"region", &Region{X: 3, Y: 5, Width: 30, Height: 30}, 7, 0, false},
+		{"overlapping blocks", nil, 7, 5, false},
+		{"grid lines on tile seams", nil, 5, 0, true},
+		{"grid lines in region", &Region{X: 3, Y: 5, Width: 30, Height: 30}, 7, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.BlockSize = tt.blockSize
+			opts.BlockStride = tt.stride
+			opts.Region = tt.region
+			opts.GridLines = tt.gridLines
+			opts.Palette = []color.RGBA{{A: 255}, {R: 255, A: 255}, {G: 255, A: 255}, {R: 255, G: 255, B: 255, A: 255}, {R: 120, G: 120, B: 120, A: 255}}
+
+			src := &memorySource{img: img}
+			sink := &memorySink{out: image.NewRGBA(img.Bounds())}
+			if err := ProcessTiled(src, sink, 20, opts); err != nil {
+				t.Fatalf("ProcessTiled() error = %v", err)
+			}
+
+			if len(sink.tiles) != 4 {
+				t.Errorf("wrote %d tiles, want 4", len(sink.tiles))
+			}
+			for _, read := range src.reads {
+				if read == img.Bounds() {
+					t.Errorf("read the whole image at once")
+				}
+			}
+
+			// With a fixed palette the tiles match the untiled mosaic exactly
+			want := CreateMosaicRGBA(img, opts)
+			for y := 0; y < 40; y++ {
+				for x := 0; x < 40; x++ {
+					if got := sink.out.RGBAAt(x, y); got != want.RGBAAt(x, y) {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want.RGBAAt(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProcessTiledSeams(t *testing.T) {
+	// Create a diagonal gradient
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 6), B: 80, A: 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.K = 6
+	opts.BlockSize = 7
+	opts.InitMethod = InitFixedSampling
+
+	sink := &memorySink{out: image.NewRGBA(img.Bounds())}
+	if err := ProcessTiled(&memorySource{img: img}, sink, 20, opts); err != nil {
+		t.Fatalf("ProcessTiled() error = %v", err)
+	}
+
+	// Blocks straddling the seams at 20 are painted in one color
+	for by := 0; by < 40; by += 7 {
+		for bx := 0; bx < 40; bx += 7 {
+			block := image.Rect(bx, by, bx+7, by+7).Intersect(img.Bounds())
+			first := sink.out.RGBAAt(block.Min.X, block.Min.Y)
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					if got := sink.out.RGBAAt(x, y); got != first {
+						t.Fatalf("block %v pixel (%d,%d) = %v, want %v", block, x, y, got, first)
+					}
+				}
+			}
+		}
+	}
+
+	// Errors are reported
+	if err := ProcessTiled(&memorySource{img: img}, failingSink{}, 20, opts); err == nil {
+		t.Errorf("ProcessTiled() with failing sink error = nil, want error")
+	}
+	if err := ProcessTiled(&memorySource{img: img}, sink, 0, opts); err == nil {
+		t.Errorf("ProcessTiled() with tile size 0 error = nil, want error")
+	}
+}
@@ -0,0 +1,68 @@
+package mosaic
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// ExportTiles writes every block of the mosaic of the first region to dir as
+// a block-sized PNG named tile_<row>_<col>.png by its grid position, so
+// that tiles can be edited individually and reassembled. Tiles always follow
+// the regular grid, so AdaptiveBlocks, DensityMap, LayoutHex, BlockJitter
+// and CollapseBlocks are ignored.
+// Parts of edge tiles past the image are transparent.
+func ExportTiles(img image.Image, opts *MosaicOptions, dir string) error {
+	opts = opts.Normalize()
+	grid := *opts
+	grid.AdaptiveBlocks = false
+	grid.DensityMap = nil
+	grid.BlockLayout = LayoutGrid
+	grid.CollapseBlocks = false
+	grid.BlockJitter = 0
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("mosaic: creating tile directory: %w", err)
+	}
+
+	mosaic := CreateMosaic(img, &grid)
+	region := grid.withInvertedRegions().regions(img.Bounds())[0]
+	stride := grid.blockStride()
+
+	for _, rect := range regionBlocks(img, region, &grid) {
+		row := (rect.Min.Y - region.Y) / stride.Y
+		col := (rect.Min.X - region.X) / stride.X
+
+		tile := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(tile, tile.Bounds(), mosaic, rect.Min, draw.Src)
+
+		name := filepath.Join(dir, fmt.Sprintf("tile_%d_%d.png", row, col))
+		if err := writePNG(name, tile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writePNG encodes img as a PNG file at name
+func writePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("mosaic: creating tile: %w", err)
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("mosaic: encoding tile %s: %w", name, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("mosaic: writing tile %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestExportTiles(t *testing.T) {
+	// Create test image that is not a multiple of the block size
+	width, height := 35, 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 7), G: uint8(y * 12), A: 255})
+		}
+	}
+
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.K = 4
+
+	if err := ExportTiles(img, opts, dir); err != nil {
+		t.Fatalf("ExportTiles() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	want := []string{
+		"tile_0_0.png", "tile_0_1.png", "tile_0_2.png", "tile_0_3.png",
+		"tile_1_0.png", "tile_1_1.png", "tile_1_2.png", "tile_1_3.png",
+	}
+	if len(names) != len(want) {
+		t.Fatalf("got tiles %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("tile %d = %s, want %s", i, names[i], want[i])
+		}
+	}
+
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tile, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("decoding %s: %v", name, err)
+		}
+		if got := tile.Bounds(); got.Dx() != opts.BlockSize || got.Dy() != opts.BlockSize {
+			t.Errorf("%s is %dx%d, want %dx%d", name, got.Dx(), got.Dy(), opts.BlockSize, opts.BlockSize)
+		}
+	}
+}
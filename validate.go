@@ -0,0 +1,164 @@
+package mosaic
+
+import "fmt"
+
+// Validate reports the first option with a value that makes no sense, such
+// as a K or BlockSize below 1, a negative Tolerance or an Opacity above 1.
+// Regions are checked against the image by Region.Normalize instead.
+// DefaultOptions and the result of Normalize always pass.
+func (opts *MosaicOptions) Validate() error {
+	checks := []struct {
+		name    string
+		value   any
+		invalid bool
+		want    string
+	}{
+		{"K", opts.K, opts.K < 1, "at least 1"},
+		{"BlockSize", opts.BlockSize, opts.BlockSize < 1, "at least 1"},
+		{"Iterations", opts.Iterations, opts.Iterations < 1, "at least 1"},
+		{"Tolerance", opts.Tolerance, opts.Tolerance < 0, "at least 0"},
+		{"MinIterations", opts.MinIterations, opts.MinIterations < 0, "at least 0"},
+		{"ConvergenceMode", opts.ConvergenceMode, opts.ConvergenceMode < ConvergenceAbsolute || opts.ConvergenceMode > ConvergenceRelative, "a ConvergenceMode constant"},
+		{"BlockWidth", opts.BlockWidth, opts.BlockWidth < 0, "at least 0"},
+		{"BlockHeight", opts.BlockHeight, opts.BlockHeight < 0, "at least 0"},
+		{"BlockStride", opts.BlockStride, opts.BlockStride < 0, "at least 0"},
+		{"BlockJitter", opts.BlockJitter, opts.BlockJitter < 0, "at least 0"},
+		{"DistanceWeights", opts.DistanceWeights, min(opts.DistanceWeights[0], opts.DistanceWeights[1], opts.DistanceWeights[2]) < 0, "no negative weights"},
+		{"BlockSample", opts.BlockSample, opts.BlockSample < SampleAverage || opts.BlockSample > SampleMostSaturated, "a BlockSample constant"},
+		{"BlockLayout", opts.BlockLayout, opts.BlockLayout < LayoutGrid || opts.BlockLayout > LayoutVStripe, "a BlockLayout constant"},
+		{"BlockShape", opts.BlockShape, opts.BlockShape < BlockSquare || opts.BlockShape > BlockCircle, "a BlockShape constant"},
+		{"MinBlockSize", opts.MinBlockSize, opts.MinBlockSize < 0, "at least 0"},
+		{"VarianceThreshold", opts.VarianceThreshold, opts.VarianceThreshold < 0, "at least 0"},
+		{"EdgeThreshold", opts.EdgeThreshold, opts.EdgeThreshold < 0, "at least 0"},
+		{"GridWidth", opts.GridWidth, opts.GridWidth < 0, "at least 0"},
+		{"Opacity", opts.Opacity, opts.Opacity < 0 || opts.Opacity > 1, "between 0 and 1"},
+		{"FeatherRadius", opts.FeatherRadius, opts.FeatherRadius < 0, "at least 0"},
+		{"ClusterAlgorithm", opts.ClusterAlgorithm, opts.ClusterAlgorithm < AlgoLloyd || opts.ClusterAlgorithm > AlgoMiniBatch, "a ClusterAlgorithm constant"},
+		{"InitMethod", opts.InitMethod, opts.InitMethod < InitRandom || opts.InitMethod > InitPlusPlus, "an InitMethod constant"},
+		{"Workers", opts.Workers, opts.Workers < 0, "at least 0"},
+		{"BatchSize", opts.BatchSize, opts.BatchSize < 0, "at least 0"},
+		{"MergeThreshold", opts.MergeThreshold, opts.MergeThreshold < 0, "at least 0"},
+		{"PreBlurRadius", opts.PreBlurRadius, opts.PreBlurRadius < 0, "at least 0"},
+		{"SampleRate", opts.SampleRate, opts.SampleRate < 0 || opts.SampleRate > 1, "between 0 and 1"},
+		{"WeightPower", opts.WeightPower, opts.WeightPower < 0, "at least 0"},
+		{"CentroidCacheBits", opts.CentroidCacheBits, opts.CentroidCacheBits < 0, "at least 0"},
+		{"PaletteSnapGrid", opts.PaletteSnapGrid, opts.PaletteSnapGrid < 0, "at least 0"},
+		{"GuideStrength", opts.GuideStrength, opts.GuideStrength < 0, "at least 0"},
+		{"ExcludeTolerance", opts.ExcludeTolerance, opts.ExcludeTolerance < 0, "at least 0"},
+		{"FrameDelay", opts.FrameDelay, opts.FrameDelay < 0, "at least 0"},
+		{"SaturationScale", opts.SaturationScale, opts.SaturationScale < 0, "at least 0"},
+		{"BrightnessScale", opts.BrightnessScale, opts.BrightnessScale < 0, "at least 0"},
+		{"KeyTolerance", opts.KeyTolerance, opts.KeyTolerance < 0, "at least 0"},
+	}
+	for _, c := range checks {
+		if c.invalid {
+			return fmt.Errorf("mosaic: %s is %v, want %s", c.name, c.value, c.want)
+		}
+	}
+
+	for i, spec := range opts.RegionSpecs {
+		if spec.K < 0 || spec.BlockSize < 0 {
+			return fmt.Errorf("mosaic: RegionSpecs[%d] has K %d and BlockSize %d, want at least 0", i, spec.K, spec.BlockSize)
+		}
+	}
+	return nil
+}
+
+// Normalize returns a copy of the options that passes Validate. Zero values
+// of options that DefaultOptions sets (such as K, BlockSize, Iterations and
+// MinBlockSize) are filled from it, as are nonsensical values of them. The
+// thresholds VarianceThreshold, EdgeThreshold and KeyTolerance keep zero and
+// only negative values are replaced by the default. Other out of range
+// values are clamped to the nearest valid value, and unknown enum values
+// become the default constant. AdaptiveBlocks is turned on for a
+// PositionRamp. A nil receiver gives DefaultOptions.
+func (opts *MosaicOptions) Normalize() *MosaicOptions {
+	defaults := DefaultOptions()
+	if opts == nil {
+		return defaults
+	}
+	n := *opts
+
+	// Options with a default that must be positive
+	for _, v := range []struct {
+		field *int
+		def   int
+	}{
+		{&n.K, defaults.K},
+		{&n.BlockSize, defaults.BlockSize},
+		{&n.Iterations, defaults.Iterations},
+		{&n.MinBlockSize, defaults.MinBlockSize},
+		{&n.BatchSize, defaults.BatchSize},
+		{&n.FrameDelay, defaults.FrameDelay},
+	} {
+		if *v.field <= 0 {
+			*v.field = v.def
+		}
+	}
+
+	// Thresholds with a default where zero is meaningful, e.g. a KeyTolerance
+	// of 0 keys out only the exact background color
+	for _, v := range []struct {
+		field *float64
+		def   float64
+	}{
+		{&n.VarianceThreshold, defaults.VarianceThreshold},
+		{&n.EdgeThreshold, defaults.EdgeThreshold},
+		{&n.KeyTolerance, defaults.KeyTolerance},
+	} {
+		if *v.field < 0 {
+			*v.field = v.def
+		}
+	}
+
+	// Options where zero is meaningful or means unset
+	for _, field := range []*int{&n.MinIterations, &n.BlockWidth, &n.BlockHeight, &n.BlockStride, &n.BlockJitter, &n.GridWidth, &n.FeatherRadius, &n.Workers, &n.PreBlurRadius, &n.CentroidCacheBits, &n.PaletteSnapGrid} {
+		*field = max(*field, 0)
+	}
+	for _, field := range []*float64{&n.Tolerance, &n.MergeThreshold, &n.WeightPower, &n.GuideStrength, &n.ExcludeTolerance, &n.SaturationScale, &n.BrightnessScale} {
+		*field = max(*field, 0)
+	}
+	n.Opacity = clamp01(n.Opacity)
+	n.SampleRate = clamp01(n.SampleRate)
+
+	for i, w := range n.DistanceWeights {
+		n.DistanceWeights[i] = max(w, 0)
+	}
+	if n.DistanceWeights == [3]float64{} {
+		n.DistanceWeights = defaults.DistanceWeights
+	}
+
+	if n.ConvergenceMode < ConvergenceAbsolute || n.ConvergenceMode > ConvergenceRelative {
+		n.ConvergenceMode = ConvergenceAbsolute
+	}
+	if n.BlockSample < SampleAverage || n.BlockSample > SampleMostSaturated {
+		n.BlockSample = SampleAverage
+	}
+	if n.BlockLayout < LayoutGrid || n.BlockLayout > LayoutVStripe {
+		n.BlockLayout = LayoutGrid
+	}
+	if n.BlockShape < BlockSquare || n.BlockShape > BlockCircle {
+		n.BlockShape = BlockSquare
+	}
+	if n.ClusterAlgorithm < AlgoLloyd || n.ClusterAlgorithm > AlgoMiniBatch {
+		n.ClusterAlgorithm = AlgoLloyd
+	}
+	if n.InitMethod < InitRandom || n.InitMethod > InitPlusPlus {
+		n.InitMethod = InitRandom
+	}
+
+	// Ramp colors follow the block structure of the image content
+	if len(n.PositionRamp) > 0 {
+		n.AdaptiveBlocks = true
+	}
+
+	if len(n.RegionSpecs) > 0 {
+		n.RegionSpecs = append([]RegionSpec(nil), n.RegionSpecs...)
+		for i := range n.RegionSpecs {
+			n.RegionSpecs[i].K = max(n.RegionSpecs[i].K, 0)
+			n.RegionSpecs[i].BlockSize = max(n.RegionSpecs[i].BlockSize, 0)
+		}
+	}
+
+	return &n
+}
@@ -0,0 +1,139 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := DefaultOptions().Validate(); err != nil {
+		t.Fatalf("DefaultOptions().Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		field  string
+		modify func(*MosaicOptions)
+	}{
+		{"K", func(o *MosaicOptions) { o.K = 0 }},
+		{"BlockSize", func(o *MosaicOptions) { o.BlockSize = -1 }},
+		{"Iterations", func(o *MosaicOptions) { o.Iterations = 0 }},
+		{"Tolerance", func(o *MosaicOptions) { o.Tolerance = -0.1 }},
+		{"MinIterations", func(o *MosaicOptions) { o.MinIterations = -1 }},
+		{"ConvergenceMode", func(o *MosaicOptions) { o.ConvergenceMode = 5 }},
+		{"BlockWidth", func(o *MosaicOptions) { o.BlockWidth = -1 }},
+		{"BlockHeight", func(o *MosaicOptions) { o.BlockHeight = -1 }},
+		{"BlockStride", func(o *MosaicOptions) { o.BlockStride = -1 }},
+		{"BlockJitter", func(o *MosaicOptions) { o.BlockJitter = -1 }},
+		{"DistanceWeights", func(o *MosaicOptions) { o.DistanceWeights = [3]float64{1, -1, 1} }},
+		{"BlockSample", func(o *MosaicOptions) { o.BlockSample = -1 }},
+		{"BlockLayout", func(o *MosaicOptions) { o.BlockLayout = 9 }},
+		{"BlockShape", func(o *MosaicOptions) { o.BlockShape = 2 }},
+		{"MinBlockSize", func(o *MosaicOptions) { o.MinBlockSize = -1 }},
+		{"VarianceThreshold", func(o *MosaicOptions) { o.VarianceThreshold = -1 }},
+		{"EdgeThreshold", func(o *MosaicOptions) { o.EdgeThreshold = -1 }},
+		{"GridWidth", func(o *MosaicOptions) { o.GridWidth = -2 }},
+		{"Opacity", func(o *MosaicOptions) { o.Opacity = 1.5 }},
+		{"FeatherRadius", func(o *MosaicOptions) { o.FeatherRadius = -3 }},
+		{"ClusterAlgorithm", func(o *MosaicOptions) { o.ClusterAlgorithm = 2 }},
+		{"InitMethod", func(o *MosaicOptions) { o.InitMethod = 3 }},
+		{"Workers", func(o *MosaicOptions) { o.Workers = -1 }},
+		{"BatchSize", func(o *MosaicOptions) { o.BatchSize = -1 }},
+		{"MergeThreshold", func(o *MosaicOptions) { o.MergeThreshold = -1 }},
+		{"PreBlurRadius", func(o *MosaicOptions) { o.PreBlurRadius = -1 }},
+		{"SampleRate", func(o *MosaicOptions) { o.SampleRate = 2 }},
+		{"WeightPower", func(o *MosaicOptions) { o.WeightPower = -1 }},
+		{"CentroidCacheBits", func(o *MosaicOptions) { o.CentroidCacheBits = -1 }},
+		{"PaletteSnapGrid", func(o *MosaicOptions) { o.PaletteSnapGrid = -1 }},
+		{"GuideStrength", func(o *MosaicOptions) { o.GuideStrength = -1 }},
+		{"ExcludeTolerance", func(o *MosaicOptions) { o.ExcludeTolerance = -1 }},
+		{"FrameDelay", func(o *MosaicOptions) { o.FrameDelay = -1 }},
+		{"SaturationScale", func(o *MosaicOptions) { o.SaturationScale = -1 }},
+		{"BrightnessScale", func(o *MosaicOptions) { o.BrightnessScale = -1 }},
+		{"KeyTolerance", func(o *MosaicOptions) { o.KeyTolerance = -1 }},
+		{"RegionSpecs", func(o *MosaicOptions) { o.RegionSpecs = []RegionSpec{{K: -1}} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(opts)
+
+			err := opts.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.field) {
+				t.Fatalf("Validate() error = %v, want an error naming %s", err, tt.field)
+			}
+
+			// Normalize repairs the field
+			if err := opts.Normalize().Validate(); err != nil {
+				t.Errorf("Normalize().Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 8), G: uint8(y * 12), A: 255})
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts *MosaicOptions
+	}{
+		{"nil", nil},
+		{"zero value", &MosaicOptions{}},
+		{"partially filled", &MosaicOptions{K: 3, Opacity: 0.5}},
+		{"nonsensical", &MosaicOptions{K: -2, BlockSize: -5, Iterations: -1, Tolerance: -1, Opacity: 3, SampleRate: -1, BlockLayout: 7, DistanceWeights: [3]float64{-1, -1, -1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts.Normalize()
+			if err := opts.Validate(); err != nil {
+				t.Fatalf("Normalize().Validate() error = %v", err)
+			}
+			if opts == tt.opts {
+				t.Fatalf("Normalize() returned the receiver, want a copy")
+			}
+			if result := CreateMosaic(img, tt.opts); result.Bounds() != img.Bounds() {
+				t.Errorf("CreateMosaic() bounds = %v, want %v", result.Bounds(), img.Bounds())
+			}
+		})
+	}
+
+	// Zero values are filled from the defaults while set values are kept
+	opts := (&MosaicOptions{K: 3}).Normalize()
+	defaults := DefaultOptions()
+	if opts.K != 3 || opts.BlockSize != defaults.BlockSize || opts.Iterations != defaults.Iterations {
+		t.Errorf("Normalize() K, BlockSize, Iterations = %d, %d, %d, want 3, %d, %d",
+			opts.K, opts.BlockSize, opts.Iterations, defaults.BlockSize, defaults.Iterations)
+	}
+	if opts.Tolerance != 0 {
+		t.Errorf("Normalize() Tolerance = %v, want 0 kept", opts.Tolerance)
+	}
+	if opts.MinBlockSize != defaults.MinBlockSize {
+		t.Errorf("Normalize() MinBlockSize = %d, want %d", opts.MinBlockSize, defaults.MinBlockSize)
+	}
+
+	// Zero thresholds are meaningful, e.g. exact-match keying
+	zero := DefaultOptions()
+	zero.VarianceThreshold, zero.EdgeThreshold, zero.KeyTolerance = 0, 0, 0
+	opts = zero.Normalize()
+	if opts.VarianceThreshold != 0 || opts.EdgeThreshold != 0 || opts.KeyTolerance != 0 {
+		t.Errorf("Normalize() VarianceThreshold, EdgeThreshold, KeyTolerance = %v, %v, %v, want 0 kept",
+			opts.VarianceThreshold, opts.EdgeThreshold, opts.KeyTolerance)
+	}
+}
+
+func TestValidateStructLiteral(t *testing.T) {
+	// Options only variable block sizing uses may be left unset
+	opts := &MosaicOptions{K: 2, BlockSize: 10, Iterations: 10, Tolerance: 0.001}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}